@@ -3,6 +3,6 @@ module github.com/decoi-io/mint
 go 1.23.4
 
 require (
-	github.com/edsrzf/mmap-go v1.2.0 // indirect
-	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
+	github.com/edsrzf/mmap-go v1.2.0
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
 )
@@ -5,7 +5,8 @@
 //
 // The benchmarks in this file measure various real-world access patterns and
 // cache behaviors, including pure cache hits, misses, sequential and random
-// reads, eviction stress, GC effects, and concurrent workloads. Together, they
+// reads, eviction stress, GC effects, concurrent workloads, and a comparison of
+// the eviction policies on skewed and scan-heavy workloads. Together, they
 // help validate cache performance, concurrency safety, and overall disk I/O
 // efficiency across different usage patterns.
 package diskview
@@ -24,10 +25,16 @@ var pageSize int64 = int64(os.Getpagesize())
 // setup initializes a temporary DiskViewer instance for benchmarking.
 // It creates a new temporary directory and data file with the given cache capacity.
 func setup(b *testing.B, capacity int) *DiskViewer {
+	return setupConfig(b, Config{MaxCapacity: capacity})
+}
+
+// setupConfig initializes a temporary DiskViewer instance for benchmarking
+// with the given configuration.
+func setupConfig(b *testing.B, config Config) *DiskViewer {
 	dir := b.TempDir()
 	file := filepath.Join(dir, "bench.data")
 
-	view, err := New(file, Config{MaxCapacity: capacity})
+	view, err := New(file, config)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -322,3 +329,69 @@ func BenchmarkConcurrent_MixedReadWrite(b *testing.B) {
 		}
 	})
 }
+
+// evictionWorkloads are page access patterns used to compare eviction policies.
+// Each returns the next page to read from a data set of the given size.
+var evictionWorkloads = []struct {
+	name string
+	next func(r *rand.Rand, zipf *rand.Zipf, i, pages int) int64
+}{
+	// Zipf models a skewed workload where a few pages receive most reads.
+	{"Zipf", func(r *rand.Rand, zipf *rand.Zipf, i, pages int) int64 {
+		return int64(zipf.Uint64())
+	}},
+	// ScanMixed interleaves the skewed workload with a sequential scan over
+	// the whole data set, as a range query running next to point lookups.
+	{"ScanMixed", func(r *rand.Rand, zipf *rand.Zipf, i, pages int) int64 {
+		if i%2 == 0 {
+			return int64(zipf.Uint64())
+		}
+		return int64(i/2) % int64(pages)
+	}},
+	// Loop repeatedly scans a working set slightly larger than the cache,
+	// the worst case for LRU.
+	{"Loop", func(r *rand.Rand, zipf *rand.Zipf, i, pages int) int64 {
+		return int64(i % (pages / 8))
+	}},
+}
+
+// BenchmarkEviction compares the eviction policies on skewed and scan-heavy
+// workloads. Besides the time per read, it reports the cache hit rate, which
+// is what the policies actually compete on.
+func BenchmarkEviction(b *testing.B) {
+	const (
+		pages    = 10_000
+		capacity = 1000
+	)
+	for _, workload := range evictionWorkloads {
+		for _, algorithm := range []EvictionAlgorithm{LRU, Clock, TwoQ, TinyLFU} {
+			b.Run(workload.name+"/"+algorithm.String(), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(pageSize)
+
+				view := setupConfig(b, Config{MaxCapacity: capacity, Eviction: algorithm})
+				defer view.Close()
+
+				for range pages {
+					_, _ = view.Create()
+				}
+
+				r := rand.New(rand.NewSource(42))
+				zipf := rand.NewZipf(r, 1.1, 1, pages-1)
+				start := view.Stats()
+				b.ResetTimer()
+				for i := range b.N {
+					_, _ = view.Read(workload.next(r, zipf, i, pages))
+				}
+				b.StopTimer()
+
+				stats := view.Stats()
+				hits := stats.Hits - start.Hits
+				misses := stats.Misses - start.Misses
+				if total := hits + misses; total > 0 {
+					b.ReportMetric(100*float64(hits)/float64(total), "hit%")
+				}
+			})
+		}
+	}
+}
@@ -5,73 +5,132 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/decoi-io/mint/internal/errs"
 	"github.com/edsrzf/mmap-go"
 )
 
 // ErrCacheMiss is returned when a requested cache entry is not found.
 var ErrCacheMiss = errors.New("cache miss")
 
-// CacheNode represents a single node in the doubly-linked list used by the LRU cache.
-// Each node stores an ID, associated data, and pointers to the next and previous nodes.
+// Stats is a snapshot of cache activity.
+type Stats struct {
+	// Hits is the number of lookups served from the cache.
+	Hits uint64
+	// PinnedHits is the number of Hits served by pinned pages.
+	PinnedHits uint64
+	// Misses is the number of pages loaded into the cache.
+	Misses uint64
+	// Pages is the number of cached pages, including pinned ones.
+	Pages int
+	// PinnedPages is the number of pinned pages.
+	PinnedPages int
+	// Bytes is the number of mapped bytes held by cached pages, including
+	// pinned ones.
+	Bytes int64
+	// RetiredBytes is the number of mapped bytes held by evicted pages that
+	// are waiting for active Guards to exit before being unmapped.
+	RetiredBytes int64
+}
+
+// DirtyPage describes a cached page with modifications that have not been flushed.
+type DirtyPage struct {
+	ID   int64
+	Data mmap.MMap
+	// Start and End delimit the modified byte range [Start, End).
+	Start int
+	End   int
+}
+
+// CacheNode represents a single cached page.
+// Each node stores an ID and the associated data.
+// The dirty range [dirtyStart, dirtyEnd) covers the bytes modified through WriteAt;
+// it is empty when both bounds are equal. Pinned nodes are not tracked by the
+// eviction policy; held nodes are tracked but never chosen as victims.
 type CacheNode struct {
-	id   int64
-	data mmap.MMap
-	next *CacheNode
-	prev *CacheNode
+	id         int64
+	data       mmap.MMap
+	dirtyStart int
+	dirtyEnd   int
+	pinned     bool
+	held       bool
 }
 
-// Cache implements a thread-safe Least Recently Used (LRU) cache.
-// It uses a doubly-linked list for maintaining access order and a map for O(1) lookups.
-// The most recently accessed items are kept at the front of the list, while the least
-// recently accessed items are at the back and evicted when capacity is reached.
+// Cache implements a thread-safe page cache.
+// It uses a map for O(1) lookups and an EvictionPolicy, selected by
+// Config.Eviction, to choose which entries are evicted when the total mapped bytes
+// or the number of entries would exceed Config.MaxBytes or Config.MaxCapacity.
+// The default policy evicts the least recently used entry.
+//
+// Pages can be pinned into a separate partition bounded by Config.PinnedCapacity.
+// Pinned pages are taken out of the eviction policy, do not count against MaxCapacity,
+// and are never evicted until they are unpinned. This keeps small but critical
+// pages, such as index internal pages, resident while leaves churn.
+//
+// Evicted entries are not unmapped immediately. They are retired to an epoch-based
+// reclaimer and unmapped once no reader that entered before the eviction is still
+// active, so pages obtained under a Guard remain valid until the Guard exits.
 type Cache struct {
-	mu     sync.RWMutex
-	lookup map[int64]*CacheNode
-	head   *CacheNode
-	tail   *CacheNode
-	config Config
+	mu          sync.RWMutex
+	lookup      map[int64]*CacheNode
+	policy      EvictionPolicy
+	config      Config
+	reclaimer   reclaimer
+	pinned      int
+	bytes       int64
+	pinnedBytes int64
+	stats       Stats
 }
 
-// NewCache creates and initializes a new LRU cache with the given configuration.
-// If MaxCapacity is not set in the config, it defaults to 10.
-// The cache uses sentinel head and tail nodes to simplify list operations.
+// NewCache creates and initializes a new cache with the given configuration.
+// If neither MaxBytes nor MaxCapacity is set in the config, MaxCapacity defaults to 10.
 func NewCache(config Config) *Cache {
-	if config.MaxCapacity == 0 {
+	if config.MaxBytes == 0 && config.MaxCapacity == 0 {
 		config.MaxCapacity = 10
 	}
 
-	head := &CacheNode{}
-	tail := &CacheNode{}
-
-	head.next = tail
-	tail.prev = head
-
 	cache := &Cache{
 		lookup: make(map[int64]*CacheNode, config.MaxCapacity),
+		policy: newEvictionPolicy(config.Eviction),
 		config: config,
-		head:   head,
-		tail:   tail,
 	}
 	return cache
 }
 
+// Enter registers the caller as an active reader and returns a Guard.
+// Pages returned by Get while the Guard is held stay mapped until the Guard exits.
+// This operation is thread-safe.
+func (l *Cache) Enter() Guard {
+	return l.reclaimer.enter()
+}
+
+// Throttle blocks for a bounded time while too many evicted mappings are
+// waiting for active Guards to exit. Callers should call it before mapping a
+// new page, without holding locks that the Guard holders may need.
+// This operation is thread-safe.
+func (l *Cache) Throttle() {
+	l.reclaimer.throttle()
+}
+
 // Get retrieves the data associated with the given id from the cache.
-// If found, the entry is moved to the front of the LRU list (marked as recently used).
+// If found, the access is reported to the eviction policy.
 // Returns ErrCacheMiss if the id is not found in the cache.
 // This operation is thread-safe.
 func (l *Cache) Get(id int64) (mmap.MMap, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if node, ok := l.lookup[id]; ok {
-		l.moveToFront(node)
+		l.hit(node)
+		l.access(node)
 		return node.data, nil
 	}
 	return nil, ErrCacheMiss
 }
 
 // Set adds or updates an entry in the cache with the given id and data.
-// If the id already exists, its data is updated and the entry is moved to the front.
-// If the cache is at capacity, the least recently used entry is evicted.
+// If the id already exists, its data is updated and the access is reported to the
+// eviction policy. Otherwise entries chosen by the policy are evicted until the
+// new entry fits.
+// Adding a new entry counts as a miss in Stats.
 // This operation is thread-safe.
 func (l *Cache) Set(id int64, data mmap.MMap) error {
 	l.mu.Lock()
@@ -79,30 +138,277 @@ func (l *Cache) Set(id int64, data mmap.MMap) error {
 	var err error
 
 	if node, ok := l.lookup[id]; ok {
+		l.bytes += int64(len(data) - len(node.data))
+		if node.pinned {
+			l.pinnedBytes += int64(len(data) - len(node.data))
+		}
 		node.data = data
-		l.moveToFront(node)
+		l.access(node)
 		return nil
 	}
 
-	if len(l.lookup) >= l.config.MaxCapacity {
-		node := l.removeFromBack()
-		err = node.data.Unmap()
-		delete(l.lookup, node.id)
+	for !l.fits(1, int64(len(data))) {
+		evicted, e := l.evict()
+		if e != nil && err == nil {
+			err = e
+		}
+		if !evicted {
+			break
+		}
 	}
 
 	node := &CacheNode{
 		id:   id,
 		data: data,
 	}
-	l.insertAtFront(node)
+	l.policy.Insert(id)
 	l.lookup[id] = node
+	l.bytes += int64(len(data))
+	l.stats.Misses++
 	return err
 }
 
+// Fits reports whether count pages of pageSize bytes fit in the evictable partition
+// at once, ignoring what is currently cached.
+func (l *Cache) Fits(count int, pageSize int) bool {
+	return (l.config.MaxCapacity == 0 || count <= l.config.MaxCapacity) &&
+		(l.config.MaxBytes == 0 || int64(count)*int64(pageSize) <= l.config.MaxBytes)
+}
+
+// fits reports whether count more entries totalling size bytes can be added to
+// the evictable partition without exceeding its limits.
+// This is a thread-unsafe method
+func (l *Cache) fits(count int, size int64) bool {
+	entries := len(l.lookup) - l.pinned
+	bytes := l.bytes - l.pinnedBytes
+	return (l.config.MaxCapacity == 0 || entries+count <= l.config.MaxCapacity) &&
+		(l.config.MaxBytes == 0 || bytes+size <= l.config.MaxBytes)
+}
+
+// Pin moves the cached page id into the pinned partition, where it is never
+// evicted until Unpin is called. Pinning an already pinned page is a no-op.
+// Returns ErrCacheMiss if the id is not cached and errs.ErrPinLimit if the
+// pinned partition is full.
+// This operation is thread-safe.
+func (l *Cache) Pin(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return ErrCacheMiss
+	}
+	if node.pinned {
+		return nil
+	}
+	if l.pinned >= l.config.PinnedCapacity {
+		return fmt.Errorf("%w: %d pages pinned", errs.ErrPinLimit, l.pinned)
+	}
+
+	l.policy.Remove(id)
+	node.pinned = true
+	l.pinned++
+	l.pinnedBytes += int64(len(node.data))
+	return nil
+}
+
+// Hold protects the cached page id from eviction until Release is called, so
+// it cannot be chosen as a victim while a multi-page operation is still using
+// it. The page stays tracked by the eviction policy, which keeps its position
+// and recency, and keeps counting against MaxBytes and MaxCapacity. Holding an
+// already held page is a no-op.
+// Returns ErrCacheMiss if the id is not cached.
+// This operation is thread-safe.
+func (l *Cache) Hold(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return ErrCacheMiss
+	}
+	node.held = true
+	return nil
+}
+
+// Release makes the held page id evictable again. Releasing a page that is not
+// held or no longer cached is a no-op.
+// This operation is thread-safe.
+func (l *Cache) Release(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if node, ok := l.lookup[id]; ok {
+		node.held = false
+	}
+}
+
+// Unpin returns the pinned page id to the eviction policy as a newly inserted
+// entry, evicting entries chosen by the policy if the cache is over capacity.
+// Unpinning a page that is not pinned is a no-op.
+// Returns ErrCacheMiss if the id is not cached.
+// This operation is thread-safe.
+func (l *Cache) Unpin(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return ErrCacheMiss
+	}
+	if !node.pinned {
+		return nil
+	}
+
+	node.pinned = false
+	l.pinned--
+	l.pinnedBytes -= int64(len(node.data))
+	l.policy.Insert(id)
+
+	var err error
+	for !l.fits(0, 0) {
+		evicted, e := l.evict()
+		if e != nil && err == nil {
+			err = e
+		}
+		if !evicted {
+			break
+		}
+	}
+	return err
+}
+
+// Invalidate drops the page id from the cache, whether pinned or not, and
+// retires its mapping. Invalidating a page that is not cached is a no-op.
+// This operation is thread-safe.
+func (l *Cache) Invalidate(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return nil
+	}
+	if node.pinned {
+		node.pinned = false
+		l.pinned--
+		l.pinnedBytes -= int64(len(node.data))
+	} else {
+		l.policy.Remove(id)
+	}
+	delete(l.lookup, id)
+	l.bytes -= int64(len(node.data))
+	l.notify(id, EvictInvalidation)
+	return l.reclaimer.retire(node.data)
+}
+
+// Stats returns a snapshot of the cache counters.
+// This operation is thread-safe.
+func (l *Cache) Stats() Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	stats := l.stats
+	stats.Pages = len(l.lookup)
+	stats.PinnedPages = l.pinned
+	stats.Bytes = l.bytes
+	stats.RetiredBytes = l.reclaimer.retiredBytes()
+	return stats
+}
+
+// ReadAt copies the bytes of the cached page id starting at offset off into buf.
+// The copy is made while holding the cache lock, so the page cannot be evicted
+// and unmapped halfway through. Returns ErrCacheMiss if the id is not cached.
+// This operation is thread-safe.
+func (l *Cache) ReadAt(id int64, off int, buf []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	l.hit(node)
+	l.access(node)
+	return copy(buf, node.data[off:]), nil
+}
+
+// WriteAt copies data into the cached page id starting at offset off and widens
+// the page's dirty range to cover the written bytes.
+// Returns ErrCacheMiss if the id is not cached.
+// This operation is thread-safe.
+func (l *Cache) WriteAt(id int64, off int, data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	l.access(node)
+	n := copy(node.data[off:], data)
+	if n == 0 {
+		return 0, nil
+	}
+	if node.dirtyStart == node.dirtyEnd {
+		node.dirtyStart, node.dirtyEnd = off, off+n
+	} else {
+		node.dirtyStart = min(node.dirtyStart, off)
+		node.dirtyEnd = max(node.dirtyEnd, off+n)
+	}
+	return n, nil
+}
+
+// DirtyRange returns the byte range [start, end) of the cached page id that has
+// been modified through WriteAt. The range is empty when start equals end.
+// Returns ErrCacheMiss if the id is not cached.
+// This operation is thread-safe.
+func (l *Cache) DirtyRange(id int64) (int, int, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return 0, 0, ErrCacheMiss
+	}
+	return node.dirtyStart, node.dirtyEnd, nil
+}
+
+// MarkDirty widens the dirty range of the cached page id to cover the whole page,
+// for pages modified directly through their mapping rather than through WriteAt.
+// Returns ErrCacheMiss if the id is not cached.
+// This operation is thread-safe.
+func (l *Cache) MarkDirty(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.lookup[id]
+	if !ok {
+		return ErrCacheMiss
+	}
+	node.dirtyStart, node.dirtyEnd = 0, len(node.data)
+	return nil
+}
+
+// DirtyPages returns every cached page with a non-empty dirty range.
+// This operation is thread-safe.
+func (l *Cache) DirtyPages() []DirtyPage {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var dirty []DirtyPage
+	for _, node := range l.lookup {
+		if node.dirtyStart != node.dirtyEnd {
+			dirty = append(dirty, DirtyPage{ID: node.id, Data: node.data, Start: node.dirtyStart, End: node.dirtyEnd})
+		}
+	}
+	return dirty
+}
+
+// ClearDirty resets the dirty range of the cached page id once its modifications
+// are durable. Clearing a page that is not cached is a no-op.
+// This operation is thread-safe.
+func (l *Cache) ClearDirty(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if node, ok := l.lookup[id]; ok {
+		node.dirtyStart, node.dirtyEnd = 0, 0
+	}
+}
+
 // Close unmaps all cached memory-mapped regions and releases all cache resources.
-// It iterates through all cached entries, unmapping each memory-mapped region and
-// clearing the node pointers. The lookup map is reset and the sentinel head and tail
-// nodes are set to nil.
+// It iterates through all cached entries, unmapping each memory-mapped region.
+// Regions retired by eviction but not yet reclaimed are unmapped as well, regardless
+// of active Guards. The lookup map is reset and the eviction policy is dropped.
 //
 // If any unmap operation fails, Close records the first error encountered but continues
 // to unmap and clean up remaining entries to prevent resource leaks. The first error
@@ -121,46 +427,60 @@ func (c *Cache) Close() error {
 		if err := value.data.Unmap(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to unmap page %d: %w", value.id, err)
 		}
-
-		value.next, value.prev = nil, nil
+		c.notify(value.id, EvictClose)
+	}
+	if err := c.reclaimer.drain(); err != nil && firstErr == nil {
+		firstErr = err
 	}
 	c.lookup = make(map[int64]*CacheNode)
-	c.head = nil
-	c.tail = nil
+	c.pinned, c.bytes, c.pinnedBytes = 0, 0, 0
+	c.policy = nil
 	return firstErr
 }
 
-// insertAtFront adds the given node to the front of the doubly-linked list,
-// immediately after the sentinel head node.
+// evict removes the entry chosen by the eviction policy and retires its mapping.
+// Held entries are skipped. Returns false if no entry could be evicted.
+// This is a thread-unsafe method
+func (l *Cache) evict() (bool, error) {
+	id, ok := l.policy.Victim(l.isHeld)
+	if !ok {
+		return false, nil
+	}
+	node := l.lookup[id]
+	delete(l.lookup, node.id)
+	l.bytes -= int64(len(node.data))
+	l.notify(node.id, EvictCapacity)
+	return true, l.reclaimer.retire(node.data)
+}
+
+// isHeld reports whether the cached page id is held by Hold.
 // This is a thread-unsafe method
-func (l *Cache) insertAtFront(node *CacheNode) {
-	node.next = l.head.next
-	node.prev = l.head
-	l.head.next.prev = node
-	l.head.next = node
+func (l *Cache) isHeld(id int64) bool {
+	return l.lookup[id].held
 }
 
-// removeFromBack removes and returns the node at the back of the list
-// (the least recently used entry), just before the sentinel tail node.
+// notify reports an evicted page to the configured OnEvict observer.
 // This is a thread-unsafe method
-func (l *Cache) removeFromBack() *CacheNode {
-	last := l.tail.prev
-	last.prev.next = l.tail
-	l.tail.prev = last.prev
-	last.prev, last.next = nil, nil
-	return last
+func (l *Cache) notify(id int64, reason EvictReason) {
+	if l.config.OnEvict != nil {
+		l.config.OnEvict(id, reason)
+	}
 }
 
-// moveToFront moves the given node to the front of the doubly-linked list,
-// marking it as the most recently used entry. If the node is already at the front,
-// this is a no-op.
+// hit records a cache hit on the given node.
 // This is a thread-unsafe method
-func (l *Cache) moveToFront(node *CacheNode) {
-	if node == l.head.next {
-		return
+func (l *Cache) hit(node *CacheNode) {
+	l.stats.Hits++
+	if node.pinned {
+		l.stats.PinnedHits++
 	}
-	node.prev.next = node.next
-	node.next.prev = node.prev
+}
 
-	l.insertAtFront(node)
+// access reports a hit on the given node to the eviction policy. Pinned nodes
+// are not tracked by the policy, so accessing them is a no-op.
+// This is a thread-unsafe method
+func (l *Cache) access(node *CacheNode) {
+	if !node.pinned {
+		l.policy.Access(node.id)
+	}
 }
@@ -0,0 +1,237 @@
+package diskview
+
+import (
+	"fmt"
+
+	"github.com/decoi-io/mint/internal/errs"
+)
+
+// LowSpacePolicy determines how a DiskViewer reacts when allocating a page
+// would leave less than Config.MinFreeBytes of free disk space.
+type LowSpacePolicy int
+
+const (
+	// RejectWrites fails the allocation with errs.ErrNoSpace. The DiskViewer
+	// stays writable and later allocations are checked again.
+	RejectWrites LowSpacePolicy = iota
+
+	// SwitchReadOnly fails the allocation with errs.ErrNoSpace and switches the
+	// DiskViewer to read-only, so every later Create and WriteAt returns
+	// errs.ErrReadOnly. The switch is permanent: freeing disk space does not
+	// make the DiskViewer writable again, only closing and reopening it does.
+	SwitchReadOnly
+)
+
+// ReadMode selects how Read and ReadPages hand out page contents.
+type ReadMode int
+
+const (
+	// ZeroCopy returns views of the memory-mapped pages. It avoids allocation,
+	// but a page is only guaranteed to stay mapped while a Guard is held.
+	ZeroCopy ReadMode = iota
+
+	// SafeCopy returns caller-owned copies of the pages. Every read allocates,
+	// but the result stays valid for as long as the caller keeps it.
+	SafeCopy
+)
+
+// PageInitPolicy determines how new pages are initialized on Create.
+type PageInitPolicy int
+
+const (
+	// ZeroFill writes a full page of zeros for every new page, so its blocks
+	// are allocated on disk immediately.
+	ZeroFill PageInitPolicy = iota
+
+	// Sparse only extends the storage size and lets the file system allocate
+	// blocks when the page is first written. New pages still read as zeros.
+	// Storages that cannot be truncated fall back to ZeroFill.
+	//
+	// The first WriteAt or Write to a sparse page is written to the file
+	// before the mapping, so a full disk fails the write with an error.
+	// Modifying a sparse page directly through the mapping returned by Read
+	// instead allocates its blocks in a page fault, and on a full disk the
+	// process is killed with SIGBUS. The MinFreeBytes check on Create does not
+	// cover such writes. Sparse is therefore not used by any preset.
+	Sparse
+)
+
+// EvictionAlgorithm selects the EvictionPolicy used by the cache.
+type EvictionAlgorithm int
+
+const (
+	// LRU evicts the least recently used page. It suits workloads with strong
+	// recency, but a single large scan flushes the whole cache.
+	LRU EvictionAlgorithm = iota
+
+	// Clock approximates LRU with a reference bit per page, so cache hits do
+	// not reorder a list.
+	Clock
+
+	// TwoQ keeps pages seen once in a FIFO queue and only promotes pages that
+	// are referenced again shortly after eviction, so scans do not displace
+	// the hot pages.
+	TwoQ
+
+	// TinyLFU admits a page into the main cache only if its estimated access
+	// frequency beats that of the page it would replace. It is the most
+	// resistant to scans and favors long-term popularity over recency.
+	TinyLFU
+)
+
+// String returns the name of the algorithm.
+func (a EvictionAlgorithm) String() string {
+	switch a {
+	case LRU:
+		return "LRU"
+	case Clock:
+		return "Clock"
+	case TwoQ:
+		return "2Q"
+	case TinyLFU:
+		return "TinyLFU"
+	}
+	return fmt.Sprintf("EvictionAlgorithm(%d)", int(a))
+}
+
+// EvictReason describes why a page left the cache.
+type EvictReason int
+
+const (
+	// EvictCapacity means the page was chosen by the eviction policy when
+	// room was needed for another page.
+	EvictCapacity EvictReason = iota
+
+	// EvictClose means the page was dropped because the cache was closed.
+	EvictClose
+
+	// EvictInvalidation means the page was dropped because its cached
+	// contents are no longer valid, for example after the page was freed.
+	EvictInvalidation
+)
+
+// String returns the name of the reason.
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictClose:
+		return "close"
+	case EvictInvalidation:
+		return "invalidation"
+	}
+	return fmt.Sprintf("EvictReason(%d)", int(r))
+}
+
+// Config holds all configuration options for the DiskViewer.
+// Start from one of the preset profiles and adjust individual fields rather
+// than building a Config from scratch; call Validate to check the result.
+type Config struct {
+	// MaxBytes is the maximum number of mapped bytes to keep in the cache.
+	// It is the primary way to size the cache, since it holds regardless of
+	// the system's page size. Zero means no byte limit.
+	MaxBytes int64
+
+	// MaxCapacity is the maximum number of pages to keep in the cache.
+	// When both MaxBytes and MaxCapacity are set, both limits apply. Defaults
+	// to 10 if neither is specified.
+	MaxCapacity int
+
+	// Eviction selects the policy that picks which pages are evicted when the
+	// cache is full. Defaults to LRU.
+	Eviction EvictionAlgorithm
+
+	// PinnedCapacity is the maximum number of pages that can be pinned with
+	// DiskViewer.Pin. Pinned pages are held in addition to MaxBytes and
+	// MaxCapacity.
+	// Zero disables pinning.
+	PinnedCapacity int
+
+	// MinFreeBytes is the amount of free disk space that must remain after a
+	// page is allocated. Allocations that would dip below it are handled
+	// according to LowSpacePolicy. Zero disables the check, as does a storage
+	// whose free space cannot be determined.
+	MinFreeBytes uint64
+
+	// LowSpacePolicy selects the behavior when the MinFreeBytes check fails.
+	LowSpacePolicy LowSpacePolicy
+
+	// OnLowSpace, if set, is called with the current free space every time the
+	// MinFreeBytes check fails, after the policy is applied and before Create
+	// returns. It runs without the DiskViewer's lock held, so it may call Free,
+	// Flush or Create; a Create that fails the check again calls it again.
+	OnLowSpace func(free uint64)
+
+	// PageInit selects how Create initializes new pages. Defaults to ZeroFill.
+	PageInit PageInitPolicy
+
+	// OnEvict, if set, is called with the ID of every page that leaves the
+	// cache and the reason it left. It lets embedders keep their own
+	// higher-level caches coherent. The callback runs synchronously while the
+	// cache lock is held, so it must be fast and must not call back into the
+	// cache or the DiskViewer.
+	OnEvict func(id int64, reason EvictReason)
+
+	// ReadMode selects between zero-copy page views and safe copies for Read
+	// and ReadPages. Defaults to ZeroCopy. ReadCopy always copies.
+	ReadMode ReadMode
+
+	// HotPages is the number of most frequently accessed pages reported by
+	// DiskViewer.HotPages. Access frequencies are estimated with a count-min
+	// sketch on every read and write and halved periodically, so the report
+	// favors recent activity. Zero disables tracking.
+	HotPages int
+}
+
+// DefaultConfig provides sensible defaults for DiskViewer configuration.
+var DefaultConfig Config = Config{
+	MaxBytes: 4 << 20,
+}
+
+// LowMemoryConfig keeps as few pages mapped as practical, for embedders with
+// a tight memory budget that can tolerate more disk reads.
+var LowMemoryConfig Config = Config{
+	MaxBytes: 256 << 10,
+}
+
+// HighThroughputConfig caches a large working set and reserves room for
+// pinned index pages, trading memory for fewer disk reads.
+var HighThroughputConfig Config = Config{
+	MaxBytes:       256 << 20,
+	PinnedCapacity: 256,
+}
+
+// DurableConfig favors safety over speed: reads return caller-owned copies
+// that stay valid after their page is evicted and unmapped, and the
+// DiskViewer switches to read-only instead of filling the disk.
+var DurableConfig Config = Config{
+	MaxBytes:       64 << 20,
+	PinnedCapacity: 64,
+	MinFreeBytes:   64 << 20,
+	LowSpacePolicy: SwitchReadOnly,
+	ReadMode:       SafeCopy,
+}
+
+// Validate reports whether the configuration is usable. The returned error
+// wraps errs.ErrInvalidConfig and names the offending field.
+func (c Config) Validate() error {
+	switch {
+	case c.MaxBytes < 0:
+		return fmt.Errorf("%w: MaxBytes must not be negative, got %d", errs.ErrInvalidConfig, c.MaxBytes)
+	case c.MaxCapacity < 0:
+		return fmt.Errorf("%w: MaxCapacity must not be negative, got %d", errs.ErrInvalidConfig, c.MaxCapacity)
+	case c.PinnedCapacity < 0:
+		return fmt.Errorf("%w: PinnedCapacity must not be negative, got %d", errs.ErrInvalidConfig, c.PinnedCapacity)
+	case c.HotPages < 0:
+		return fmt.Errorf("%w: HotPages must not be negative, got %d", errs.ErrInvalidConfig, c.HotPages)
+	case c.LowSpacePolicy != RejectWrites && c.LowSpacePolicy != SwitchReadOnly:
+		return fmt.Errorf("%w: unknown LowSpacePolicy %d", errs.ErrInvalidConfig, c.LowSpacePolicy)
+	case c.Eviction < LRU || c.Eviction > TinyLFU:
+		return fmt.Errorf("%w: unknown Eviction %d", errs.ErrInvalidConfig, c.Eviction)
+	case c.ReadMode != ZeroCopy && c.ReadMode != SafeCopy:
+		return fmt.Errorf("%w: unknown ReadMode %d", errs.ErrInvalidConfig, c.ReadMode)
+	case c.PageInit != ZeroFill && c.PageInit != Sparse:
+		return fmt.Errorf("%w: unknown PageInit %d", errs.ErrInvalidConfig, c.PageInit)
+	}
+	return nil
+}
@@ -1,25 +1,18 @@
 package diskview
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 
+	"github.com/decoi-io/mint/internal/errs"
 	"github.com/edsrzf/mmap-go"
 )
 
-// Config holds configuration options for the DiskViewer.
-type Config struct {
-	// MaxCapacity is the maximum number of pages to keep in the LRU cache.
-	// Defaults to 10 if not specified.
-	MaxCapacity int
-}
-
-// DefaultConfig provides sensible defaults for DiskViewer configuration.
-var DefaultConfig Config = Config{
-	MaxCapacity: 10,
-}
-
-// DiskViewer provides a page-based view of a disk file with LRU caching.
+// DiskViewer provides a page-based view of a disk file with page caching.
 //
 // Thread Safety:
 // DiskViewer is internally thread-safe for concurrent reads and writes to
@@ -27,7 +20,7 @@ var DefaultConfig Config = Config{
 // operations, isolation), a higher-level transaction layer should coordinate access.
 //
 // The internal locks in DiskViewer protect:
-// - Cache consistency (LRU eviction, map updates)
+// - Cache consistency (eviction, map updates)
 // - File metadata consistency (page count, file info)
 // - Safe concurrent mmap operations
 //
@@ -35,37 +28,352 @@ var DefaultConfig Config = Config{
 // - Transaction isolation
 // - Atomic multi-page operations
 // - Serializable access to page contents
+//
+// Once closed, every operation returns errs.ErrClosed.
 type DiskViewer struct {
-	cache *Cache
-	pager *Pager
-	mu    sync.Mutex
+	cache    *Cache
+	pager    *Pager
+	config   Config
+	mu       sync.Mutex
+	closed   bool
+	readOnly bool
+	hot      *hotTracker
 }
 
 // New creates a new DiskViewer for the given source file.
 // The source file is opened in read-write mode and will be created if it doesn't exist.
-// Returns an error if the file cannot be opened or if initialization fails.
+// Returns an error if the config is invalid, the file cannot be opened, or if
+// initialization fails.
 func New(source string, config Config) (*DiskViewer, error) {
-	dv := new(DiskViewer)
-	dv.cache = NewCache(config)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	pager, err := NewPager(source)
 	if err != nil {
 		return nil, err
 	}
+	return newDiskViewer(pager, config), nil
+}
+
+// NewFromStorage creates a new DiskViewer on top of the given storage.
+// The DiskViewer takes ownership of the storage and closes it on Close.
+func NewFromStorage(storage Storage, config Config) (*DiskViewer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	pager, err := NewPagerFrom(storage)
+	if err != nil {
+		return nil, err
+	}
+	return newDiskViewer(pager, config), nil
+}
+
+// newDiskViewer wires the cache and the given pager into a DiskViewer.
+func newDiskViewer(pager *Pager, config Config) *DiskViewer {
+	dv := new(DiskViewer)
+	dv.cache = NewCache(config)
 	dv.pager = pager
-	return dv, nil
+	dv.config = config
+	if config.HotPages > 0 {
+		dv.hot = newHotTracker(config.HotPages)
+	}
+	return dv
+}
+
+// Enter registers the caller as an active reader and returns a Guard that must
+// be exited when the caller is done with the pages it read.
+//
+// A page returned by Read or ReadPages can be evicted from the cache at any
+// time by concurrent operations. Pages read while a Guard is held stay mapped
+// until the Guard exits; without a Guard, an evicted page may be unmapped while
+// the caller is still using it.
+func (d *DiskViewer) Enter() Guard {
+	return d.cache.Enter()
 }
 
 // Read retrieves the page with the given ID.
 // It first checks the cache, and if not found, loads the page from disk
-// and adds it to the cache. Returns the memory-mapped page data.
-func (d *DiskViewer) Read(id int64) (mmap.MMap, error) {
+// and adds it to the cache. In ZeroCopy mode the returned page is a view of the
+// mapping owned by the cache, which is only guaranteed to stay mapped while a
+// Guard from Enter is held. In SafeCopy mode the result is a copy owned by the
+// caller.
+//
+// Writing through the returned page only reaches the storage if it is a file,
+// whose pages are mapped directly. For other storages, such as those passed to
+// NewFromStorage, the page is a private in-memory copy and changes to it are
+// silently lost when it is evicted. Use WriteAt or Write, or call MarkDirty
+// after modifying the page, to make sure changes reach every kind of storage.
+// The first change to a page created with the Sparse PageInit policy must go
+// through WriteAt or Write; see Sparse.
+func (d *DiskViewer) Read(id int64) ([]byte, error) {
+	if d.config.ReadMode == SafeCopy {
+		return d.ReadCopy(id)
+	}
+	d.recordAccess(id)
 	if data, err := d.cache.Get(id); err == nil {
 		return data, nil
 	}
 
+	d.cache.Throttle()
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	return d.load(id)
+}
+
+// ReadPages retrieves the pages with the given IDs and returns them in the same
+// order as ids. Cached pages are served from the cache; the remaining pages are
+// sorted and grouped into runs of adjacent IDs, and each run is fetched with
+// Pager.GetPages, which reads it ahead as a whole, before the cache is populated
+// in one pass.
+//
+// Returns errs.ErrTooManyPages if ids contains more distinct pages than the cache
+// capacity, since some of the returned pages would otherwise be evicted before
+// the call returns.
+func (d *DiskViewer) ReadPages(ids []int64) ([][]byte, error) {
+	for _, id := range ids {
+		d.recordAccess(id)
+	}
+	unique := slices.Clone(ids)
+	slices.Sort(unique)
+	unique = slices.Compact(unique)
+	if !d.cache.Fits(len(unique), d.pager.pageSize) {
+		return nil, fmt.Errorf("%w: %d pages requested", errs.ErrTooManyPages, len(unique))
+	}
+
+	d.cache.Throttle()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, errs.ErrClosed
+	}
+
+	// Every requested page is held as soon as it is cached, so loading the
+	// remaining pages can only evict pages outside of this call, whatever the
+	// eviction policy.
+	defer func() {
+		for _, id := range unique {
+			d.cache.Release(id)
+		}
+	}()
+
+	pages := make(map[int64]mmap.MMap, len(unique))
+	missing := unique[:0:0]
+	for _, id := range unique {
+		if data, err := d.cache.Get(id); err == nil {
+			pages[id] = data
+			d.cache.Hold(id)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	for len(missing) > 0 {
+		count := 1
+		for count < len(missing) && missing[count] == missing[0]+int64(count) {
+			count++
+		}
 
+		run, err := d.pager.GetPages(missing[0], count)
+		if err != nil {
+			return nil, err
+		}
+		for i, data := range run {
+			id := missing[0] + int64(i)
+			if err := d.cache.Set(id, data); err != nil {
+				for _, rest := range run[i:] {
+					rest.Unmap()
+				}
+				return nil, err
+			}
+			d.cache.Hold(id)
+			pages[id] = data
+		}
+		missing = missing[count:]
+	}
+
+	// The requested pages are held and evictions only happen while d.mu is
+	// held, so the pages are still mapped and can be copied safely.
+	result := make([][]byte, len(ids))
+	for i, id := range ids {
+		if d.config.ReadMode == SafeCopy {
+			result[i] = bytes.Clone(pages[id])
+		} else {
+			result[i] = pages[id]
+		}
+	}
+	return result, nil
+}
+
+// ReadCopy returns a copy of the page with the given ID, regardless of the
+// configured ReadMode. The copy is owned by the caller and remains valid after
+// the page is evicted.
+func (d *DiskViewer) ReadCopy(id int64) ([]byte, error) {
+	data := make([]byte, d.pager.pageSize)
+	if _, err := d.ReadAt(id, 0, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadAt copies len(buf) bytes of the page with the given ID, starting at
+// offset off within the page, into buf. The page is loaded into the cache if
+// it is not already there. Returns errs.ErrOutOfBounds if the requested range does
+// not fit within a single page.
+func (d *DiskViewer) ReadAt(id int64, off int, buf []byte) (int, error) {
+	if err := d.checkBounds(off, len(buf)); err != nil {
+		return 0, err
+	}
+	d.recordAccess(id)
+	if n, err := d.cache.ReadAt(id, off, buf); !errors.Is(err, ErrCacheMiss) {
+		return n, err
+	}
+
+	// Pages are only evicted while d.mu is held, so once the page is loaded
+	// under the lock it stays mapped until the copy completes.
+	d.cache.Throttle()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, err := d.load(id)
+	if err != nil {
+		return 0, err
+	}
+	return copy(buf, data[off:]), nil
+}
+
+// WriteAt copies data into the page with the given ID, starting at offset off
+// within the page, and records the written range as dirty. The page is loaded
+// into the cache if it is not already there. Returns errs.ErrOutOfBounds if the
+// data does not fit within a single page.
+//
+// For storages that are not memory-mapped, the write is also passed through to
+// the storage so it is not lost when the page is evicted. The first write to a
+// page created with the Sparse PageInit policy is passed through as well, so a
+// full disk is reported as an error instead of a fault on the mapping.
+func (d *DiskViewer) WriteAt(id int64, off int, data []byte) (int, error) {
+	if err := d.checkBounds(off, len(data)); err != nil {
+		return 0, err
+	}
+	d.recordAccess(id)
+
+	d.cache.Throttle()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.load(id); err != nil {
+		return 0, err
+	}
+	if d.readOnly {
+		return 0, errs.ErrReadOnly
+	}
+	// The first write to a sparse page allocates its blocks. Through the
+	// mapping that happens in a page fault, which raises SIGBUS when the disk
+	// is full, so it goes through the pager first, where running out of space
+	// is an ordinary error.
+	if d.pager.file == nil || d.pager.Sparse(id) {
+		offset := id*int64(d.pager.pageSize) + int64(off)
+		if _, err := d.pager.Write(data, offset); err != nil {
+			return 0, fmt.Errorf("failed to write page %d at offset %d: %w", id, off, err)
+		}
+	}
+	return d.cache.WriteAt(id, off, data)
+}
+
+// Free releases the page with the given ID so a later Create can reuse it
+// instead of growing the storage. The page is dropped from the cache, and any
+// later access to it fails with errs.ErrPageNotFound until it is allocated
+// again. Pages obtained under a Guard stay mapped until the Guard exits.
+func (d *DiskViewer) Free(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errs.ErrClosed
+	}
+	if d.readOnly {
+		return errs.ErrReadOnly
+	}
+	if err := d.cache.Invalidate(id); err != nil {
+		return err
+	}
+	return d.pager.Free(id)
+}
+
+// MarkDirty records that the page with the given ID was modified directly
+// through the mapping returned by Read, so the next Flush makes it durable.
+// Writes made through WriteAt and Write are tracked automatically.
+//
+// For storages that are not memory-mapped, the page is written back to the
+// storage immediately, since changes to its mapping are otherwise lost on
+// eviction.
+func (d *DiskViewer) MarkDirty(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, err := d.load(id)
+	if err != nil {
+		return err
+	}
+	if d.readOnly {
+		return errs.ErrReadOnly
+	}
+	if err := d.cache.MarkDirty(id); err != nil {
+		return err
+	}
+	if d.pager.file == nil {
+		if _, err := d.pager.Write(data, id*int64(d.pager.pageSize)); err != nil {
+			return fmt.Errorf("failed to write page %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Flush makes every modification durable. It msyncs each dirty cached page,
+// fsyncs the storage, and returns only once the data is on stable storage.
+// Dirty pages that were evicted before Flush are covered by the fsync.
+// On success the dirty ranges of the flushed pages are cleared.
+func (d *DiskViewer) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errs.ErrClosed
+	}
+
+	// Evictions and tracked writes only happen while d.mu is held, so the
+	// dirty pages stay mapped and unchanged until they are cleared below.
+	dirty := d.cache.DirtyPages()
+	if d.pager.file != nil {
+		for _, page := range dirty {
+			if err := page.Data.Flush(); err != nil {
+				return fmt.Errorf("failed to flush page %d: %w", page.ID, err)
+			}
+		}
+	}
+	if err := d.pager.Sync(); err != nil {
+		return fmt.Errorf("failed to sync storage: %w", err)
+	}
+	for _, page := range dirty {
+		d.cache.ClearDirty(page.ID)
+	}
+	return nil
+}
+
+// Write replaces the contents of the page with the given ID with data. If data
+// is shorter than a page, the rest of the page is zeroed. The whole page is
+// recorded as dirty. Returns errs.ErrOutOfBounds if data is larger than a page.
+func (d *DiskViewer) Write(id int64, data []byte) error {
+	if err := d.checkBounds(0, len(data)); err != nil {
+		return err
+	}
+	page := make([]byte, d.pager.pageSize)
+	copy(page, data)
+	_, err := d.WriteAt(id, 0, page)
+	return err
+}
+
+// load returns the page with the given ID from the cache, reading it from the
+// pager and caching it on a miss.
+// The caller must hold d.mu.
+func (d *DiskViewer) load(id int64) (mmap.MMap, error) {
+	if d.closed {
+		return nil, errs.ErrClosed
+	}
 	if data, err := d.cache.Get(id); err == nil {
 		return data, nil
 	}
@@ -84,36 +392,170 @@ func (d *DiskViewer) Read(id int64) (mmap.MMap, error) {
 	return data, nil
 }
 
-// Create allocates a new page on disk by writing zeros.
-// It handles partial writes by continuing until the full page is written.
-// Returns the ID of the newly created page.
+// Create allocates a page and returns its ID. A page released by Free is
+// reused first and zeroed in place; otherwise a new page is appended to the
+// storage and initialized according to Config.PageInit. Either way the page
+// reads as zeros. Only appending is subject to the Config.MinFreeBytes check.
 func (d *DiskViewer) Create() (int64, error) {
 	d.mu.Lock()
-	defer d.mu.Unlock()
+	id, free, err := d.create()
+	d.mu.Unlock()
 
-	remaining := d.pager.pageSize
-	count, err := d.pager.PageCount()
-	if err != nil {
-		return 0, err
+	// The callback runs without d.mu held, so it can free pages or flush.
+	if errors.Is(err, errs.ErrNoSpace) && d.config.OnLowSpace != nil {
+		d.config.OnLowSpace(free)
 	}
-	offset := count * int64(d.pager.pageSize)
+	return id, err
+}
 
-	for remaining > 0 {
-		n, e := d.pager.Write(remaining, offset)
-		if e != nil {
-			return 0, fmt.Errorf("failed to write page at offset %d: %w", offset, e)
+// create allocates a page for Create. When the MinFreeBytes check fails, it
+// also returns the free space that was found.
+// The caller must hold d.mu.
+func (d *DiskViewer) create() (int64, uint64, error) {
+	if d.closed {
+		return 0, 0, errs.ErrClosed
+	}
+	if d.readOnly {
+		return 0, 0, errs.ErrReadOnly
+	}
+	// Reusing a freed page does not grow the storage, so it is allowed even
+	// when disk space is low. Free is serialized by d.mu as well, so the page
+	// is still free when it is allocated below.
+	if !d.pager.HasFree() {
+		if free, err := d.checkFreeSpace(); err != nil {
+			return 0, free, err
 		}
-		remaining -= n
-		offset += int64(n)
 	}
+	var id int64
+	var err error
+	if d.config.PageInit == Sparse {
+		id, err = d.pager.AllocateSparse()
+	} else {
+		id, err = d.pager.Allocate()
+	}
+	return id, 0, err
+}
 
-	count, err = d.pager.PageCount()
+// checkFreeSpace verifies that allocating one more page leaves at least
+// MinFreeBytes of free disk space, applying the configured LowSpacePolicy
+// and returning the free space when it does not.
+// The caller must hold d.mu.
+func (d *DiskViewer) checkFreeSpace() (uint64, error) {
+	if d.config.MinFreeBytes == 0 {
+		return 0, nil
+	}
+	free, ok, err := d.pager.freeSpace()
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to check free space: %w", err)
+	}
+	if !ok || free >= d.config.MinFreeBytes+uint64(d.pager.pageSize) {
+		return 0, nil
 	}
-	id := count - 1
 
-	return id, nil
+	if d.config.LowSpacePolicy == SwitchReadOnly {
+		d.readOnly = true
+	}
+	return free, fmt.Errorf("%w: %d bytes free, %d required", errs.ErrNoSpace, free, d.config.MinFreeBytes+uint64(d.pager.pageSize))
+}
+
+// Pages calls fn for every allocated page in ID order, passing the page contents.
+// Freed pages are skipped.
+// It is intended for external tooling that needs to process the raw file.
+//
+// The walk is consistent: the DiskViewer's lock is held for its whole duration,
+// including while fn runs, so no page is created or written through the
+// DiskViewer until Pages returns. Every other operation that needs the lock
+// waits as well: Read and ReadAt calls that miss the cache, ReadPages, WriteAt,
+// Write, MarkDirty, Create, Free, Flush, Pin, Unpin and Close. Only Read and
+// ReadAt calls served from the cache proceed during the walk.
+// Pages are read straight from the pager and do not disturb the cache. The data
+// slice is reused between calls and is only valid until fn returns; fn must not
+// modify it or call back into the DiskViewer.
+//
+// The walk stops at the first error returned by fn or when ctx is done, and
+// that error is returned.
+func (d *DiskViewer) Pages(ctx context.Context, fn func(id int64, data []byte) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errs.ErrClosed
+	}
+
+	data := make([]byte, d.pager.pageSize)
+	count := d.pager.PageCount()
+	for id := range count {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.pager.Allocated(id) {
+			continue
+		}
+		if n, err := d.pager.Read(data, id*int64(d.pager.pageSize)); n < len(data) {
+			return fmt.Errorf("failed to read page %d: %w", id, shortRead(err))
+		}
+		if err := fn(id, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pin loads the page with the given ID and pins it in the cache so it is never
+// evicted until Unpin is called. Intended for small pages that are expensive to
+// miss, such as index internal pages and metadata.
+// Returns errs.ErrPinLimit if Config.PinnedCapacity pages are already pinned.
+func (d *DiskViewer) Pin(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.load(id); err != nil {
+		return err
+	}
+	return d.cache.Pin(id)
+}
+
+// Unpin returns a pinned page to the regular cache, where it can be evicted
+// again. Unpinning a page that is not cached or not pinned is a no-op.
+func (d *DiskViewer) Unpin(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errs.ErrClosed
+	}
+	if err := d.cache.Unpin(id); err != nil && !errors.Is(err, ErrCacheMiss) {
+		return err
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the cache counters.
+func (d *DiskViewer) Stats() Stats {
+	return d.cache.Stats()
+}
+
+// HotPages returns the most frequently accessed pages, hottest first, with
+// their approximate access counts. Returns nil if Config.HotPages is zero.
+func (d *DiskViewer) HotPages() []PageHeat {
+	if d.hot == nil {
+		return nil
+	}
+	return d.hot.report()
+}
+
+// recordAccess counts an access to the page with the given ID when hot page
+// tracking is enabled.
+func (d *DiskViewer) recordAccess(id int64) {
+	if d.hot != nil {
+		d.hot.record(id)
+	}
+}
+
+// checkBounds reports whether a range of length bytes starting at off lies
+// within a single page.
+func (d *DiskViewer) checkBounds(off, length int) error {
+	if off < 0 || length < 0 || off+length > d.pager.pageSize {
+		return fmt.Errorf("%w: offset %d, length %d, page size %d", errs.ErrOutOfBounds, off, length, d.pager.pageSize)
+	}
+	return nil
 }
 
 // Close releases all resources held by the DiskViewer.
@@ -121,6 +563,10 @@ func (d *DiskViewer) Create() (int64, error) {
 func (d *DiskViewer) Close() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if d.closed {
+		return errs.ErrClosed
+	}
+	d.closed = true
 	if err := d.cache.Close(); err != nil {
 		return err
 	}
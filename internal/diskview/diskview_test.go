@@ -0,0 +1,566 @@
+package diskview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decoi-io/mint/internal/errs"
+)
+
+// newTestView creates a DiskViewer over a temporary file with the given number of pages.
+func newTestView(t *testing.T, config Config, pages int) *DiskViewer {
+	t.Helper()
+	view, err := New(filepath.Join(t.TempDir(), "test.data"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { view.Close() })
+
+	for range pages {
+		if _, err := view.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return view
+}
+
+func TestDiskViewer_ReadAtWriteAt(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 1}, 2)
+
+	if _, err := view.WriteAt(0, 100, []byte("header")); err != nil {
+		t.Fatal(err)
+	}
+	start, end, err := view.cache.DirtyRange(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 100 || end != 106 {
+		t.Fatalf("dirty range = [%d, %d), want [100, 106)", start, end)
+	}
+
+	// Evict page 0 so the read has to go back to the pager.
+	if _, err := view.Read(1); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 6)
+	if _, err := view.ReadAt(0, 100, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte("header")) {
+		t.Fatalf("ReadAt = %q, want %q", buf, "header")
+	}
+}
+
+func TestDiskViewer_ReadAtWriteAtBounds(t *testing.T) {
+	view := newTestView(t, DefaultConfig, 1)
+	pageSize := view.pager.pageSize
+
+	if _, err := view.WriteAt(0, pageSize-2, []byte("abc")); !errors.Is(err, errs.ErrOutOfBounds) {
+		t.Fatalf("WriteAt past page end: got %v, want ErrOutOfBounds", err)
+	}
+	if _, err := view.ReadAt(0, -1, make([]byte, 1)); !errors.Is(err, errs.ErrOutOfBounds) {
+		t.Fatalf("ReadAt at negative offset: got %v, want ErrOutOfBounds", err)
+	}
+}
+
+func TestDiskViewer_ReadPages(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 8}, 16)
+	// Writing pages 8 to 15 last evicts pages 0 to 7, so the reads below
+	// have to go back to the pager.
+	for id := range int64(16) {
+		if _, err := view.WriteAt(id, 0, []byte{byte(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := view.Read(3); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []int64{7, 2, 3, 1, 2, 6}
+	pages, err := view.ReadPages(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range ids {
+		if pages[i][0] != byte(id) {
+			t.Fatalf("page %d has marker %d", id, pages[i][0])
+		}
+	}
+
+	if _, err := view.ReadPages([]int64{0, 1, 2, 3, 4, 5, 6, 7, 8}); !errors.Is(err, errs.ErrTooManyPages) {
+		t.Fatalf("got %v, want ErrTooManyPages", err)
+	}
+}
+
+// TestDiskViewer_ReadPagesEviction checks that loading the missing pages of a
+// ReadPages call never evicts a page the same call returns, whatever the
+// eviction policy.
+func TestDiskViewer_ReadPagesEviction(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			view := newTestView(t, Config{MaxCapacity: 4, Eviction: algorithm}, 8)
+			for id := range int64(8) {
+				if _, err := view.WriteAt(id, 0, []byte{byte(id)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for range 4 {
+				for id := range int64(3) {
+					if _, err := view.Read(id); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			for _, ids := range [][]int64{{0, 4, 5, 6}, {7, 1, 3, 0}, {2, 5, 6, 7}} {
+				pages, err := view.ReadPages(ids)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, id := range ids {
+					if pages[i][0] != byte(id) {
+						t.Fatalf("page %d has marker %d", id, pages[i][0])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDiskViewer_Closed(t *testing.T) {
+	view := newTestView(t, DefaultConfig, 1)
+	if _, err := view.Read(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := view.Read(0); !errors.Is(err, errs.ErrClosed) {
+		t.Fatalf("Read: got %v, want ErrClosed", err)
+	}
+	if _, err := view.WriteAt(0, 0, []byte{1}); !errors.Is(err, errs.ErrClosed) {
+		t.Fatalf("WriteAt: got %v, want ErrClosed", err)
+	}
+	if _, err := view.Create(); !errors.Is(err, errs.ErrClosed) {
+		t.Fatalf("Create: got %v, want ErrClosed", err)
+	}
+	if err := view.Close(); !errors.Is(err, errs.ErrClosed) {
+		t.Fatalf("Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestDiskViewer_LowSpace(t *testing.T) {
+	var reported uint64
+	var view *DiskViewer
+	view = newTestView(t, Config{
+		MaxCapacity:    1,
+		MinFreeBytes:   1 << 62,
+		LowSpacePolicy: SwitchReadOnly,
+		// Calling back into the DiskViewer must not deadlock.
+		OnLowSpace: func(free uint64) {
+			reported = free
+			if err := view.Flush(); err != nil {
+				t.Error(err)
+			}
+		},
+	}, 0)
+	if _, ok, _ := view.pager.freeSpace(); !ok {
+		t.Skip("free space cannot be determined on this platform")
+	}
+
+	if _, err := view.Create(); !errors.Is(err, errs.ErrNoSpace) {
+		t.Fatalf("Create: got %v, want ErrNoSpace", err)
+	}
+	if reported == 0 {
+		t.Fatal("OnLowSpace was not called")
+	}
+	if _, err := view.Create(); !errors.Is(err, errs.ErrReadOnly) {
+		t.Fatalf("Create after switch: got %v, want ErrReadOnly", err)
+	}
+}
+
+func TestDiskViewer_LowSpaceReusesFreedPage(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 1}, 2)
+	if _, ok, _ := view.pager.freeSpace(); !ok {
+		t.Skip("free space cannot be determined on this platform")
+	}
+	if err := view.Free(0); err != nil {
+		t.Fatal(err)
+	}
+	view.config.MinFreeBytes = 1 << 62
+	view.config.LowSpacePolicy = SwitchReadOnly
+
+	id, err := view.Create()
+	if err != nil {
+		t.Fatalf("Create of a freed page: %v", err)
+	}
+	if id != 0 {
+		t.Fatalf("Create = %d, want reused page 0", id)
+	}
+	if _, err := view.Create(); !errors.Is(err, errs.ErrNoSpace) {
+		t.Fatalf("Create with an empty free list: got %v, want ErrNoSpace", err)
+	}
+}
+
+func TestDiskViewer_SafeCopy(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 1, ReadMode: SafeCopy}, 2)
+	if _, err := view.WriteAt(0, 0, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := view.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Evict page 0; the copy must stay readable and detached from the mapping.
+	if _, err := view.Read(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.WriteAt(0, 0, []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(page, []byte("first")) {
+		t.Fatalf("copy = %q, want prefix %q", page[:5], "first")
+	}
+}
+
+func TestDiskViewer_HotPages(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 4, HotPages: 2}, 8)
+	for id := range int64(8) {
+		reads := 1
+		switch id {
+		case 5:
+			reads = 50
+		case 2:
+			reads = 20
+		}
+		for range reads {
+			if _, err := view.Read(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	hot := view.HotPages()
+	if len(hot) != 2 || hot[0].ID != 5 || hot[1].ID != 2 {
+		t.Fatalf("HotPages = %v, want pages 5 then 2", hot)
+	}
+	if hot[0].Count < 50 {
+		t.Fatalf("page 5 count = %d, want at least 50", hot[0].Count)
+	}
+}
+
+func TestDiskViewer_HotPagesDecay(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 4, HotPages: 1}, 2)
+	for id, reads := range []int{30_000, 20_000} {
+		for range reads {
+			if _, err := view.Read(int64(id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	hot := view.HotPages()
+	if len(hot) != 1 || hot[0].ID != 1 {
+		t.Fatalf("HotPages = %v, want page 1, which was read more recently", hot)
+	}
+	if hot[0].Count >= 20_000 {
+		t.Fatalf("page 1 count = %d, want it halved at least once", hot[0].Count)
+	}
+}
+
+func TestHotTracker_TopK(t *testing.T) {
+	tracker := newHotTracker(8)
+	// Page i is accessed 3*(i+1) times, interleaved so the top set keeps changing.
+	for round := range 3 * 64 {
+		for id := int64(round / 3); id < 64; id++ {
+			tracker.record(id)
+		}
+	}
+
+	hot := tracker.report()
+	if len(hot) != 8 {
+		t.Fatalf("report has %d pages, want 8", len(hot))
+	}
+	for i, heat := range hot {
+		if want := int64(63 - i); heat.ID != want {
+			t.Fatalf("report[%d] = page %d, want page %d", i, heat.ID, want)
+		}
+	}
+}
+
+func TestHotTracker_DecayOnRecord(t *testing.T) {
+	tracker := newHotTracker(1)
+	for range 6000 {
+		tracker.record(1)
+	}
+	// The last access to page 2 triggers the decay, which halves page 1 to
+	// 3000. Page 2 must be compared with its halved count of 2120, not with
+	// the 4240 it had before the decay.
+	for range hotSampleSize*sketchWidth - 6000 {
+		tracker.record(2)
+	}
+
+	hot := tracker.report()
+	if len(hot) != 1 || hot[0].ID != 1 || hot[0].Count != 3000 {
+		t.Fatalf("report = %v, want page 1 with count 3000", hot)
+	}
+}
+
+func TestDiskViewer_Pin(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 2, PinnedCapacity: 1}, 6)
+	if err := view.Pin(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Pin(1); !errors.Is(err, errs.ErrPinLimit) {
+		t.Fatalf("Pin over budget: got %v, want ErrPinLimit", err)
+	}
+
+	// Churn through the other pages; the pinned page must survive.
+	for id := int64(1); id < 6; id++ {
+		if _, err := view.Read(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := view.Read(0); err != nil {
+		t.Fatal(err)
+	}
+	stats := view.Stats()
+	if stats.PinnedHits != 1 || stats.PinnedPages != 1 || stats.Pages != 3 {
+		t.Fatalf("Stats = %+v, want 1 pinned hit, 1 pinned page, 3 pages", stats)
+	}
+
+	if err := view.Unpin(0); err != nil {
+		t.Fatal(err)
+	}
+	if stats := view.Stats(); stats.Pages != 2 || stats.PinnedPages != 0 {
+		t.Fatalf("Stats after Unpin = %+v, want 2 pages, 0 pinned", stats)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, config := range []Config{DefaultConfig, LowMemoryConfig, HighThroughputConfig, DurableConfig} {
+		if err := config.Validate(); err != nil {
+			t.Fatalf("preset %+v is invalid: %v", config, err)
+		}
+	}
+
+	_, err := New(filepath.Join(t.TempDir(), "test.data"), Config{MaxCapacity: -1})
+	if !errors.Is(err, errs.ErrInvalidConfig) {
+		t.Fatalf("New with negative capacity: got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestDiskViewer_SparsePageInit(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 2, PageInit: Sparse}, 3)
+	if count := view.pager.PageCount(); count != 3 {
+		t.Fatalf("PageCount = %d, want 3", count)
+	}
+
+	page, err := view.ReadCopy(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(page, make([]byte, len(page))) {
+		t.Fatal("sparse page does not read as zeros")
+	}
+
+	// The first write to a sparse page goes through the pager, and later
+	// writes go through the mapping again.
+	if !view.pager.Sparse(2) {
+		t.Fatal("new page is not reported as sparse")
+	}
+	if _, err := view.WriteAt(2, 10, []byte("sparse")); err != nil {
+		t.Fatal(err)
+	}
+	if view.pager.Sparse(2) {
+		t.Fatal("written page is still reported as sparse")
+	}
+	stored := make([]byte, 6)
+	if _, err := view.pager.Read(stored, 2*int64(view.pager.pageSize)+10); err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != "sparse" {
+		t.Fatalf("storage holds %q, want %q", stored, "sparse")
+	}
+	if start, end, _ := view.cache.DirtyRange(2); start != 10 || end != 16 {
+		t.Fatalf("DirtyRange = [%d, %d), want [10, 16)", start, end)
+	}
+}
+
+func TestDiskViewer_Pages(t *testing.T) {
+	view := newTestView(t, DefaultConfig, 4)
+	for id := range int64(4) {
+		if _, err := view.WriteAt(id, 0, []byte{byte(id + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []byte
+	err := view.Pages(context.Background(), func(id int64, data []byte) error {
+		seen = append(seen, data[0])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(seen, []byte{1, 2, 3, 4}) {
+		t.Fatalf("visited markers %v, want [1 2 3 4]", seen)
+	}
+
+	stop := errors.New("stop")
+	visits := 0
+	err = view.Pages(context.Background(), func(id int64, data []byte) error {
+		visits++
+		return stop
+	})
+	if !errors.Is(err, stop) || visits != 1 {
+		t.Fatalf("Pages = %v after %d visits, want stop after 1", err, visits)
+	}
+}
+
+func TestDiskViewer_OnEvict(t *testing.T) {
+	evicted := map[EvictReason][]int64{}
+	view := newTestView(t, Config{
+		MaxCapacity: 1,
+		OnEvict: func(id int64, reason EvictReason) {
+			evicted[reason] = append(evicted[reason], id)
+		},
+	}, 2)
+
+	for id := range int64(2) {
+		if _, err := view.Read(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := view.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := evicted[EvictCapacity]; len(got) != 1 || got[0] != 0 {
+		t.Fatalf("capacity evictions = %v, want [0]", got)
+	}
+	if got := evicted[EvictClose]; len(got) != 1 || got[0] != 1 {
+		t.Fatalf("close evictions = %v, want [1]", got)
+	}
+}
+
+func TestDiskViewer_Write(t *testing.T) {
+	view := newTestView(t, DefaultConfig, 1)
+	pageSize := view.pager.pageSize
+
+	if _, err := view.WriteAt(0, 10, []byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Write(0, []byte("fresh")); err != nil {
+		t.Fatal(err)
+	}
+	page, err := view.ReadCopy(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, pageSize)
+	copy(want, "fresh")
+	if !bytes.Equal(page, want) {
+		t.Fatalf("page starts with %q, want %q followed by zeros", page[:15], "fresh")
+	}
+	if start, end, _ := view.cache.DirtyRange(0); start != 0 || end != pageSize {
+		t.Fatalf("dirty range = [%d, %d), want the whole page", start, end)
+	}
+
+	if err := view.Write(0, make([]byte, pageSize+1)); !errors.Is(err, errs.ErrOutOfBounds) {
+		t.Fatalf("oversized Write: got %v, want ErrOutOfBounds", err)
+	}
+}
+
+func TestDiskViewer_Free(t *testing.T) {
+	view := newTestView(t, DefaultConfig, 3)
+	if _, err := view.WriteAt(1, 0, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := view.Free(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.Read(1); !errors.Is(err, errs.ErrPageNotFound) {
+		t.Fatalf("Read of freed page: got %v, want ErrPageNotFound", err)
+	}
+	if err := view.Free(1); !errors.Is(err, errs.ErrPageNotFound) {
+		t.Fatalf("double Free: got %v, want ErrPageNotFound", err)
+	}
+
+	id, err := view.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatalf("Create = %d, want reused page 1", id)
+	}
+	if count := view.pager.PageCount(); count != 3 {
+		t.Fatalf("PageCount = %d, want 3", count)
+	}
+	page, err := view.ReadCopy(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(page, make([]byte, len(page))) {
+		t.Fatal("reused page was not zeroed")
+	}
+}
+
+func TestDiskViewer_MaxBytes(t *testing.T) {
+	pageSize := int64(os.Getpagesize())
+	view := newTestView(t, Config{MaxBytes: 3 * pageSize}, 5)
+	for id := range int64(5) {
+		if _, err := view.Read(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := view.Stats()
+	if stats.Pages != 3 || stats.Bytes != 3*pageSize {
+		t.Fatalf("Stats = %+v, want 3 pages and %d bytes", stats, 3*pageSize)
+	}
+	if _, err := view.ReadPages([]int64{0, 1, 2, 3}); !errors.Is(err, errs.ErrTooManyPages) {
+		t.Fatalf("ReadPages over MaxBytes: got %v, want ErrTooManyPages", err)
+	}
+}
+
+func TestDiskViewer_Flush(t *testing.T) {
+	view := newTestView(t, DefaultConfig, 2)
+	if _, err := view.WriteAt(0, 4, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	page, err := view.Read(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(page, "direct")
+	if err := view.MarkDirty(1); err != nil {
+		t.Fatal(err)
+	}
+	if dirty := view.cache.DirtyPages(); len(dirty) != 2 {
+		t.Fatalf("DirtyPages = %d pages, want 2", len(dirty))
+	}
+
+	if err := view.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if dirty := view.cache.DirtyPages(); len(dirty) != 0 {
+		t.Fatalf("DirtyPages after Flush = %d pages, want 0", len(dirty))
+	}
+
+	buf := make([]byte, 6)
+	if _, err := view.pager.Read(buf, int64(view.pager.pageSize)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte("direct")) {
+		t.Fatalf("storage = %q, want %q", buf, "direct")
+	}
+}
@@ -0,0 +1,138 @@
+// Package diskviewtest provides Storage implementations for testing code built
+// on top of diskview: an in-memory storage and a wrapper that injects faults
+// and latency into another storage.
+//
+// The types satisfy diskview.Storage structurally, so this package does not
+// import diskview and can be used from diskview's own tests.
+package diskviewtest
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/decoi-io/mint/internal/errs"
+)
+
+// Storage mirrors diskview.Storage.
+type Storage interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Sync() error
+	Size() (int64, error)
+}
+
+// MemStorage is an in-memory Storage. The zero value is an empty storage
+// ready to use. It grows as data is written past its end.
+type MemStorage struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// ReadAt reads len(p) bytes starting at off. It returns io.EOF if fewer bytes
+// are available.
+func (m *MemStorage) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes p at off, growing the storage if needed.
+func (m *MemStorage) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+// Sync is a no-op.
+func (m *MemStorage) Sync() error { return nil }
+
+// Close is a no-op; the contents stay available through Bytes.
+func (m *MemStorage) Close() error { return nil }
+
+// Size returns the number of bytes stored.
+func (m *MemStorage) Size() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.data)), nil
+}
+
+// Bytes returns the current contents. The slice aliases the storage and is
+// only valid until the next write that grows it.
+func (m *MemStorage) Bytes() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data
+}
+
+// FaultStorage wraps a Storage and injects failures and latency into its I/O
+// operations. ReadAt, WriteAt and Sync count as operations; Size and Close
+// are passed through untouched.
+type FaultStorage struct {
+	Storage
+
+	// FailAt makes the FailAt-th operation (counting from 1) fail with
+	// errs.ErrIOFailure without reaching the wrapped storage. Zero disables
+	// fault injection.
+	FailAt int64
+
+	// Latency is slept before every operation.
+	Latency time.Duration
+
+	ops atomic.Int64
+}
+
+// Ops returns the number of operations performed so far, including failed ones.
+func (f *FaultStorage) Ops() int64 {
+	return f.ops.Load()
+}
+
+// ReadAt reads from the wrapped storage unless a fault is injected.
+func (f *FaultStorage) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.before("read", off); err != nil {
+		return 0, err
+	}
+	return f.Storage.ReadAt(p, off)
+}
+
+// WriteAt writes to the wrapped storage unless a fault is injected.
+func (f *FaultStorage) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.before("write", off); err != nil {
+		return 0, err
+	}
+	return f.Storage.WriteAt(p, off)
+}
+
+// Sync syncs the wrapped storage unless a fault is injected.
+func (f *FaultStorage) Sync() error {
+	if err := f.before("sync", 0); err != nil {
+		return err
+	}
+	return f.Storage.Sync()
+}
+
+// before counts an operation, applies the latency and reports whether the
+// operation must fail.
+func (f *FaultStorage) before(op string, off int64) error {
+	n := f.ops.Add(1)
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+	if f.FailAt != 0 && n == f.FailAt {
+		return fmt.Errorf("%w: injected on %s at offset %d (operation %d)", errs.ErrIOFailure, op, off, n)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package diskview
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// epochSlots is the number of epochs tracked at once. Readers can only be
+// active in the current or the previous epoch, and the third slot holds the
+// mappings retired in the epoch before that while they wait to be unmapped.
+const epochSlots = 3
+
+const (
+	// maxRetired is the number of retired mappings above which new pages are
+	// only mapped after waiting for reclamation. It keeps a stalled reader
+	// from exhausting the process's mapping limit (vm.max_map_count on Linux).
+	maxRetired = 4096
+
+	// retireWait is how long a load waits for retired mappings to drop below
+	// maxRetired before it maps the page anyway. The wait is bounded because
+	// the loading reader may itself hold a Guard that blocks reclamation.
+	retireWait = 50 * time.Millisecond
+)
+
+// Guard marks a reader as active in an epoch. Pages obtained while a Guard is
+// held stay mapped until the Guard exits, even if they are evicted from the
+// cache in the meantime. Guards are cheap: entering and exiting only touch a
+// pair of atomic counters.
+//
+// Guards should be short-lived. While any Guard from an older epoch is held,
+// no evicted page can be unmapped. Once maxRetired mappings are waiting, loads
+// of new pages are throttled until the Guard exits.
+type Guard struct {
+	reclaimer *reclaimer
+	epoch     uint64
+}
+
+// Exit ends the reader's epoch. Pages obtained under the Guard must not be
+// accessed after Exit returns. If mappings are waiting to be unmapped and the
+// Guard was the last reader of its epoch, or loads are throttled, Exit reclaims
+// what it can and wakes the throttled loads.
+func (g Guard) Exit() {
+	r := g.reclaimer
+	remaining := r.readers[g.epoch%epochSlots].Add(-1)
+	if r.pending.Load() == 0 || remaining != 0 && r.waiting.Load() == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Exit cannot report an unmap failure, and the mapping is dropped either way.
+	_ = r.reclaim()
+}
+
+// reclaimer implements epoch-based reclamation for evicted page mappings.
+// Instead of unmapping a page as soon as it leaves the cache, the mapping is
+// retired into the current epoch and only unmapped once every reader that may
+// still hold it has exited.
+//
+// The global epoch can advance from e to e+1 only when no reader is left in
+// epoch e-1. A mapping retired in epoch e-1 was removed from the cache before
+// the epoch became e, so once the epoch reaches e+1 no reader can reach it and
+// it is unmapped.
+//
+// The number of retired mappings is kept close to maxRetired: once it is
+// reached, throttle makes loads wait for reclamation, letting at most one load
+// through at a time while every active reader is waiting.
+type reclaimer struct {
+	epoch   atomic.Uint64
+	readers [epochSlots]atomic.Int64
+	pending atomic.Int64
+	waiting atomic.Int64
+	mu      sync.Mutex
+	retired [epochSlots][]mmap.MMap
+	waiters []*waiter
+}
+
+// waiter is a load blocked in throttle. Its ready channel is closed when the
+// load is woken to check the retired mappings again, or released to proceed
+// regardless.
+type waiter struct {
+	ready    chan struct{}
+	released bool
+}
+
+// notify wakes the load if it is blocked.
+// The caller must hold the reclaimer's mu.
+func (w *waiter) notify() {
+	if w.ready != nil {
+		close(w.ready)
+		w.ready = nil
+	}
+}
+
+// enter registers a reader in the current epoch and returns its Guard.
+// This operation is thread-safe.
+func (r *reclaimer) enter() Guard {
+	for {
+		epoch := r.epoch.Load()
+		r.readers[epoch%epochSlots].Add(1)
+		if r.epoch.Load() == epoch {
+			return Guard{reclaimer: r, epoch: epoch}
+		}
+		// The epoch advanced before the reader was visible; retry so the
+		// reader is never counted in an epoch that may already be drained.
+		r.readers[epoch%epochSlots].Add(-1)
+	}
+}
+
+// retire schedules data to be unmapped once no reader can still hold it.
+// It then tries to advance the epoch so that, when no readers are active,
+// the mapping is unmapped immediately.
+// This operation is thread-safe.
+func (r *reclaimer) retire(data mmap.MMap) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	epoch := r.epoch.Load()
+	r.retired[epoch%epochSlots] = append(r.retired[epoch%epochSlots], data)
+	r.pending.Add(1)
+	return r.reclaim()
+}
+
+// throttle blocks while at least maxRetired mappings are waiting to be
+// unmapped, giving the readers that hold them a chance to exit. The caller
+// may itself hold a Guard that keeps the mappings alive, so when every active
+// reader is throttled, the load that has waited longest is let through; the
+// loads take turns in arrival order until the readers blocking reclamation
+// can exit. A load waits at most retireWait.
+// This operation is thread-safe.
+func (r *reclaimer) throttle() {
+	if r.pending.Load() < maxRetired {
+		return
+	}
+	timer := time.NewTimer(retireWait)
+	defer timer.Stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := &waiter{}
+	r.waiters = append(r.waiters, w)
+	r.waiting.Store(int64(len(r.waiters)))
+	for !w.released && r.pending.Load() >= maxRetired {
+		ready := make(chan struct{})
+		w.ready = ready
+		r.releaseStalled()
+		if w.released {
+			return
+		}
+
+		r.mu.Unlock()
+		select {
+		case <-ready:
+		case <-timer.C:
+			r.mu.Lock()
+			r.dequeue(w)
+			return
+		}
+		r.mu.Lock()
+	}
+	r.dequeue(w)
+}
+
+// releaseStalled lets the longest waiting load through if every active reader
+// is throttled, since none of them can exit its Guard otherwise.
+// The caller must hold r.mu.
+func (r *reclaimer) releaseStalled() {
+	var active int64
+	for slot := range r.readers {
+		active += r.readers[slot].Load()
+	}
+	if len(r.waiters) == 0 || active > int64(len(r.waiters)) {
+		return
+	}
+	w := r.waiters[0]
+	r.dequeue(w)
+	w.released = true
+	w.notify()
+}
+
+// wake lets the throttled loads check the retired mappings again. They keep
+// their place in line.
+// The caller must hold r.mu.
+func (r *reclaimer) wake() {
+	for _, w := range r.waiters {
+		w.notify()
+	}
+}
+
+// dequeue removes w from the throttled loads if it is still queued.
+// The caller must hold r.mu.
+func (r *reclaimer) dequeue(w *waiter) {
+	if i := slices.Index(r.waiters, w); i >= 0 {
+		r.waiters = slices.Delete(r.waiters, i, i+1)
+		r.waiting.Store(int64(len(r.waiters)))
+	}
+}
+
+// reclaim advances the epoch as far as the active readers allow, unmapping the
+// mappings that became unreachable, and wakes the throttled loads.
+// The caller must hold r.mu.
+func (r *reclaimer) reclaim() error {
+	var firstErr error
+	for range epochSlots - 1 {
+		advanced, err := r.tryAdvance()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if !advanced {
+			break
+		}
+	}
+	r.wake()
+	return firstErr
+}
+
+// tryAdvance moves the global epoch forward if the previous epoch has no
+// readers left, unmapping the mappings that became unreachable.
+// The caller must hold r.mu.
+func (r *reclaimer) tryAdvance() (bool, error) {
+	epoch := r.epoch.Load()
+	previous := (epoch + epochSlots - 1) % epochSlots
+	if r.readers[previous].Load() != 0 {
+		return false, nil
+	}
+	r.epoch.Store(epoch + 1)
+
+	// The slot of the previous epoch is now the slot two epochs behind.
+	var firstErr error
+	for _, data := range r.retired[previous] {
+		if err := data.Unmap(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to unmap retired page: %w", err)
+		}
+	}
+	r.pending.Add(-int64(len(r.retired[previous])))
+	r.retired[previous] = nil
+	return true, firstErr
+}
+
+// retiredBytes returns the number of bytes held by mappings waiting to be unmapped.
+// This operation is thread-safe.
+func (r *reclaimer) retiredBytes() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for _, retired := range r.retired {
+		for _, data := range retired {
+			total += int64(len(data))
+		}
+	}
+	return total
+}
+
+// drain unmaps every retired mapping regardless of active readers.
+// It is only safe to call once no reader can access pages any more.
+// This operation is thread-safe.
+func (r *reclaimer) drain() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var firstErr error
+	for slot := range r.retired {
+		for _, data := range r.retired[slot] {
+			if err := data.Unmap(); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to unmap retired page: %w", err)
+			}
+		}
+		r.retired[slot] = nil
+	}
+	r.pending.Store(0)
+	r.wake()
+	return firstErr
+}
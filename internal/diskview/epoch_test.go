@@ -0,0 +1,90 @@
+package diskview
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// TestReclaimer_StressEvictionUnderReaders hammers a tiny cache with readers
+// that hold guarded pages while concurrent reads evict them. Without deferred
+// unmapping, touching an evicted page faults; run with -race to also check the
+// epoch bookkeeping, and with GOMAXPROCS=1 to check that preempted readers do
+// not let retired mappings pile up past the mapping limit.
+func TestReclaimer_StressEvictionUnderReaders(t *testing.T) {
+	const pages = 64
+	view := newTestView(t, Config{MaxCapacity: 2}, pages)
+	for id := range int64(pages) {
+		if _, err := view.WriteAt(id, 0, []byte{byte(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(worker)))
+			for range 2000 {
+				guard := view.Enter()
+				id := int64(r.Intn(pages))
+				page, err := view.Read(id)
+				if err != nil {
+					guard.Exit()
+					t.Error(err)
+					return
+				}
+				for range 4 {
+					if _, err := view.Read(int64(r.Intn(pages))); err != nil {
+						t.Error(err)
+					}
+				}
+				if page[0] != byte(id) {
+					t.Errorf("page %d has marker %d", id, page[0])
+				}
+				if n := view.cache.reclaimer.pending.Load(); n > maxRetired+1024 {
+					t.Errorf("%d retired mappings, want at most about %d", n, maxRetired)
+				}
+				guard.Exit()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReclaimer_UnmapsWithoutReaders(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 1}, 3)
+	for id := range int64(3) {
+		if _, err := view.Read(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &view.cache.reclaimer
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for slot, retired := range r.retired {
+		if len(retired) != 0 {
+			t.Fatalf("slot %d still holds %d retired pages", slot, len(retired))
+		}
+	}
+}
+
+func TestReclaimer_ExitUnmaps(t *testing.T) {
+	view := newTestView(t, Config{MaxCapacity: 1}, 3)
+	guard := view.Enter()
+	for id := range int64(3) {
+		if _, err := view.Read(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if retired := view.Stats().RetiredBytes; retired == 0 {
+		t.Fatal("evicted pages were unmapped under an active Guard")
+	}
+
+	guard.Exit()
+	if retired := view.Stats().RetiredBytes; retired != 0 {
+		t.Fatalf("RetiredBytes after Exit = %d, want 0", retired)
+	}
+}
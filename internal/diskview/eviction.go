@@ -0,0 +1,488 @@
+package diskview
+
+// EvictionPolicy decides which cached page is evicted when the cache needs room.
+// The cache reports every page that enters, is accessed in, or leaves the
+// evictable partition, and asks the policy for a victim when it is full.
+// Pinned pages are never tracked by the policy. Pages held by a multi-page
+// read stay tracked, but the cache asks the policy to skip them when choosing
+// a victim, so they keep their position and recency.
+//
+// Implementations are not required to be thread-safe: the cache only calls them
+// while holding its own lock.
+type EvictionPolicy interface {
+	// Insert starts tracking a page that was added to the cache.
+	Insert(id int64)
+
+	// Access records a cache hit on a tracked page.
+	Access(id int64)
+
+	// Remove stops tracking a page that left the cache for a reason other
+	// than eviction, such as being pinned or invalidated. Removing an
+	// untracked page is a no-op.
+	Remove(id int64)
+
+	// Victim selects the next page to evict and stops tracking it. Pages
+	// for which skip returns true are not evicted and keep their position,
+	// as if Victim had not looked at them. Returns false if every tracked
+	// page is skipped or no page is tracked.
+	Victim(skip func(id int64) bool) (int64, bool)
+
+	// Len returns the number of tracked pages.
+	Len() int
+}
+
+// newEvictionPolicy creates the policy implementing the given algorithm.
+func newEvictionPolicy(algorithm EvictionAlgorithm) EvictionPolicy {
+	switch algorithm {
+	case Clock:
+		return newClockPolicy()
+	case TwoQ:
+		return newTwoQPolicy()
+	case TinyLFU:
+		return newTinyLFUPolicy()
+	}
+	return newLRUPolicy()
+}
+
+// lruPolicy evicts the least recently used page.
+type lruPolicy struct {
+	list idList
+}
+
+// newLRUPolicy creates an empty LRU policy.
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{list: newIDList()}
+}
+
+// Insert adds the page as the most recently used entry.
+func (p *lruPolicy) Insert(id int64) {
+	p.list.pushFront(id)
+}
+
+// Access marks the page as the most recently used entry.
+func (p *lruPolicy) Access(id int64) {
+	p.list.moveToFront(id)
+}
+
+// Remove stops tracking the page.
+func (p *lruPolicy) Remove(id int64) {
+	p.list.remove(id)
+}
+
+// Victim removes and returns the least recently used page that is not skipped.
+func (p *lruPolicy) Victim(skip func(id int64) bool) (int64, bool) {
+	id, ok := p.list.last(skip)
+	if ok {
+		p.list.remove(id)
+	}
+	return id, ok
+}
+
+// Len returns the number of tracked pages.
+func (p *lruPolicy) Len() int {
+	return p.list.len()
+}
+
+// clockEntry is a single slot of the clock ring.
+type clockEntry struct {
+	id         int64
+	referenced bool
+	used       bool
+}
+
+// clockPolicy approximates LRU with the CLOCK algorithm. Pages sit in a ring
+// with a reference bit that is set on access. The hand sweeps the ring and
+// evicts the first page whose bit is clear, clearing bits as it passes, so a
+// page survives one full sweep for every access. Hits only set a bit instead
+// of relinking a list.
+type clockPolicy struct {
+	ring  []clockEntry
+	index map[int64]int
+	free  []int
+	hand  int
+}
+
+// newClockPolicy creates an empty CLOCK policy.
+func newClockPolicy() *clockPolicy {
+	return &clockPolicy{index: make(map[int64]int)}
+}
+
+// Insert places the page in a free slot of the ring with its reference bit clear.
+func (p *clockPolicy) Insert(id int64) {
+	entry := clockEntry{id: id, used: true}
+	if n := len(p.free); n > 0 {
+		slot := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.ring[slot] = entry
+		p.index[id] = slot
+		return
+	}
+	p.ring = append(p.ring, entry)
+	p.index[id] = len(p.ring) - 1
+}
+
+// Access sets the reference bit of the page.
+func (p *clockPolicy) Access(id int64) {
+	if slot, ok := p.index[id]; ok {
+		p.ring[slot].referenced = true
+	}
+}
+
+// Remove frees the slot of the page.
+func (p *clockPolicy) Remove(id int64) {
+	slot, ok := p.index[id]
+	if !ok {
+		return
+	}
+	delete(p.index, id)
+	p.ring[slot] = clockEntry{}
+	p.free = append(p.free, slot)
+}
+
+// Victim advances the hand to the first unreferenced page that is not skipped
+// and removes it. Skipped pages keep their reference bit. The hand gives up
+// after two full sweeps, by which time every reference bit it could clear has
+// been cleared.
+func (p *clockPolicy) Victim(skip func(id int64) bool) (int64, bool) {
+	if len(p.index) == 0 {
+		return 0, false
+	}
+	for range 2*len(p.ring) + 1 {
+		if p.hand >= len(p.ring) {
+			p.hand = 0
+		}
+		entry := &p.ring[p.hand]
+		p.hand++
+		if !entry.used || skip(entry.id) {
+			continue
+		}
+		if entry.referenced {
+			entry.referenced = false
+			continue
+		}
+		id := entry.id
+		p.Remove(id)
+		return id, true
+	}
+	return 0, false
+}
+
+// Len returns the number of tracked pages.
+func (p *clockPolicy) Len() int {
+	return len(p.index)
+}
+
+const (
+	// twoQInShare is the fraction of tracked pages, in percent, that the 2Q
+	// FIFO queue may hold before it is evicted from first.
+	twoQInShare = 25
+
+	// twoQGhostShare is the number of evicted page IDs, as a percentage of
+	// the tracked pages, that 2Q remembers to detect re-references.
+	twoQGhostShare = 50
+)
+
+// twoQPolicy implements the simplified 2Q algorithm. New pages enter a FIFO
+// queue and are evicted from it without disturbing the main LRU queue unless
+// they are referenced again shortly after eviction, which is detected with a
+// ghost queue of recently evicted IDs. A sequential scan therefore only
+// churns the FIFO queue and leaves the hot pages in the main queue resident.
+type twoQPolicy struct {
+	in    idList
+	ghost idList
+	main  idList
+}
+
+// newTwoQPolicy creates an empty 2Q policy.
+func newTwoQPolicy() *twoQPolicy {
+	return &twoQPolicy{
+		in:    newIDList(),
+		ghost: newIDList(),
+		main:  newIDList(),
+	}
+}
+
+// Insert adds the page to the main queue if it was evicted recently, and to
+// the FIFO queue otherwise.
+func (p *twoQPolicy) Insert(id int64) {
+	if p.ghost.remove(id) {
+		p.main.pushFront(id)
+		return
+	}
+	p.in.pushFront(id)
+}
+
+// Access marks a page in the main queue as the most recently used entry.
+// Pages in the FIFO queue keep their position.
+func (p *twoQPolicy) Access(id int64) {
+	p.main.moveToFront(id)
+}
+
+// Remove stops tracking the page without remembering it as evicted.
+func (p *twoQPolicy) Remove(id int64) {
+	if !p.in.remove(id) {
+		p.main.remove(id)
+	}
+}
+
+// Victim evicts the oldest page of the FIFO queue while it is over its share,
+// or the least recently used page of the main queue otherwise. If every page
+// of the preferred queue is skipped, the other queue is used. Pages evicted
+// from the FIFO queue are remembered in the ghost queue.
+func (p *twoQPolicy) Victim(skip func(id int64) bool) (int64, bool) {
+	if p.main.len() == 0 || p.in.len()*100 > p.Len()*twoQInShare {
+		if id, ok := p.in.last(skip); ok {
+			return p.evictIn(id), true
+		}
+	}
+	if id, ok := p.main.last(skip); ok {
+		p.main.remove(id)
+		return id, true
+	}
+	if id, ok := p.in.last(skip); ok {
+		return p.evictIn(id), true
+	}
+	return 0, false
+}
+
+// evictIn removes the page from the FIFO queue and remembers it in the ghost
+// queue, trimming the ghost queue to its share. Returns the page ID.
+func (p *twoQPolicy) evictIn(id int64) int64 {
+	p.in.remove(id)
+	p.ghost.pushFront(id)
+	for p.ghost.len() > max(1, p.Len()*twoQGhostShare/100) {
+		p.ghost.popBack()
+	}
+	return id
+}
+
+// Len returns the number of tracked pages, excluding the ghost queue.
+func (p *twoQPolicy) Len() int {
+	return p.in.len() + p.main.len()
+}
+
+const (
+	// tinyLFUWindowShare is the fraction of tracked pages, in percent, kept
+	// in the TinyLFU admission window. The window holds at least one page.
+	tinyLFUWindowShare = 1
+
+	// tinyLFUSampleSize is the number of recorded accesses, as a multiple of
+	// the sketch width, after which all frequencies are halved.
+	tinyLFUSampleSize = 10
+)
+
+// tinyLFUPolicy implements W-TinyLFU with a plain LRU main queue. New pages
+// enter a small LRU admission window. When the cache is full and the window is
+// over its share, its oldest page competes with the least recently used page of
+// the main queue: the one with the higher estimated access frequency stays and
+// the other is evicted. Frequencies are estimated with a count-min sketch that
+// is halved periodically, so pages that were popular long ago lose their
+// advantage. One-off accesses such as scans rarely win admission to the main
+// queue.
+type tinyLFUPolicy struct {
+	window  idList
+	main    idList
+	sketch  [sketchDepth][sketchWidth]uint32
+	samples int
+}
+
+// newTinyLFUPolicy creates an empty TinyLFU policy.
+func newTinyLFUPolicy() *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		window: newIDList(),
+		main:   newIDList(),
+	}
+}
+
+// Insert records an access to the page and adds it to the admission window.
+func (p *tinyLFUPolicy) Insert(id int64) {
+	p.record(id)
+	p.window.pushFront(id)
+}
+
+// Access records an access to the page and marks it as the most recently used
+// entry of its queue.
+func (p *tinyLFUPolicy) Access(id int64) {
+	p.record(id)
+	if !p.window.moveToFront(id) {
+		p.main.moveToFront(id)
+	}
+}
+
+// Remove stops tracking the page. Its frequency estimate is kept.
+func (p *tinyLFUPolicy) Remove(id int64) {
+	if !p.window.remove(id) {
+		p.main.remove(id)
+	}
+}
+
+// Victim first moves pages that were admitted while the cache had room from the
+// admission window into the main queue, leaving the window one page over its
+// share. That page then competes with the least recently used page of the main
+// queue and the loser is evicted. If the window is within its share, the least
+// recently used page of the main queue is evicted. Skipped pages take no part
+// in the contest.
+func (p *tinyLFUPolicy) Victim(skip func(id int64) bool) (int64, bool) {
+	share := max(1, p.Len()*tinyLFUWindowShare/100)
+	for p.window.len() > share+1 {
+		id, _ := p.window.popBack()
+		p.main.pushFront(id)
+	}
+
+	victim, ok := p.main.last(skip)
+	if !ok {
+		id, ok := p.window.last(skip)
+		if ok {
+			p.window.remove(id)
+		}
+		return id, ok
+	}
+	candidate, ok := p.window.last(skip)
+	if !ok || p.window.len() <= share {
+		p.main.remove(victim)
+		return victim, true
+	}
+	p.window.remove(candidate)
+	if p.estimate(candidate) <= p.estimate(victim) {
+		return candidate, true
+	}
+	p.main.remove(victim)
+	p.main.pushFront(candidate)
+	return victim, true
+}
+
+// Len returns the number of tracked pages.
+func (p *tinyLFUPolicy) Len() int {
+	return p.window.len() + p.main.len()
+}
+
+// record increments the frequency estimate of the page, halving every counter
+// once enough accesses have been sampled.
+func (p *tinyLFUPolicy) record(id int64) {
+	for row := range sketchDepth {
+		p.sketch[row][sketchSlot(row, id)]++
+	}
+	p.samples++
+	if p.samples >= tinyLFUSampleSize*sketchWidth {
+		for row := range sketchDepth {
+			for i := range sketchWidth {
+				p.sketch[row][i] >>= 1
+			}
+		}
+		p.samples /= 2
+	}
+}
+
+// estimate returns the estimated access frequency of the page.
+func (p *tinyLFUPolicy) estimate(id int64) uint32 {
+	estimate := p.sketch[0][sketchSlot(0, id)]
+	for row := 1; row < sketchDepth; row++ {
+		estimate = min(estimate, p.sketch[row][sketchSlot(row, id)])
+	}
+	return estimate
+}
+
+// idNode is a single entry of an idList.
+type idNode struct {
+	id   int64
+	next *idNode
+	prev *idNode
+}
+
+// idList is a doubly-linked list of page IDs with O(1) lookup by ID, ordered
+// from the most recently inserted entry at the front to the oldest at the back.
+// It uses sentinel head and tail nodes to simplify list operations.
+type idList struct {
+	head  *idNode
+	tail  *idNode
+	nodes map[int64]*idNode
+}
+
+// newIDList creates an empty list.
+func newIDList() idList {
+	head := &idNode{}
+	tail := &idNode{}
+	head.next = tail
+	tail.prev = head
+	return idList{head: head, tail: tail, nodes: make(map[int64]*idNode)}
+}
+
+// len returns the number of entries in the list.
+func (l *idList) len() int {
+	return len(l.nodes)
+}
+
+// pushFront adds id to the front of the list.
+func (l *idList) pushFront(id int64) {
+	node := &idNode{id: id}
+	l.link(node)
+	l.nodes[id] = node
+}
+
+// moveToFront moves id to the front of the list.
+// Returns false if id is not in the list.
+func (l *idList) moveToFront(id int64) bool {
+	node, ok := l.nodes[id]
+	if !ok {
+		return false
+	}
+	if node != l.head.next {
+		l.unlink(node)
+		l.link(node)
+	}
+	return true
+}
+
+// remove removes id from the list. Returns false if id is not in the list.
+func (l *idList) remove(id int64) bool {
+	node, ok := l.nodes[id]
+	if !ok {
+		return false
+	}
+	l.unlink(node)
+	delete(l.nodes, id)
+	return true
+}
+
+// back returns the entry at the back of the list without removing it.
+func (l *idList) back() (int64, bool) {
+	if l.len() == 0 {
+		return 0, false
+	}
+	return l.tail.prev.id, true
+}
+
+// last returns the entry closest to the back of the list for which skip returns
+// false, without removing it.
+func (l *idList) last(skip func(id int64) bool) (int64, bool) {
+	for node := l.tail.prev; node != l.head; node = node.prev {
+		if !skip(node.id) {
+			return node.id, true
+		}
+	}
+	return 0, false
+}
+
+// popBack removes and returns the entry at the back of the list.
+func (l *idList) popBack() (int64, bool) {
+	id, ok := l.back()
+	if ok {
+		l.remove(id)
+	}
+	return id, ok
+}
+
+// link inserts node immediately after the sentinel head node.
+func (l *idList) link(node *idNode) {
+	node.next = l.head.next
+	node.prev = l.head
+	l.head.next.prev = node
+	l.head.next = node
+}
+
+// unlink detaches node from its neighbours.
+func (l *idList) unlink(node *idNode) {
+	node.prev.next = node.next
+	node.next.prev = node.prev
+	node.prev, node.next = nil, nil
+}
@@ -0,0 +1,141 @@
+package diskview
+
+import (
+	"math/rand"
+	"testing"
+)
+
+var algorithms = []EvictionAlgorithm{LRU, Clock, TwoQ, TinyLFU}
+
+// keep is a Victim skip function that skips no page.
+func keep(id int64) bool { return false }
+
+// TestEvictionPolicy_Tracking checks that every policy evicts exactly the pages
+// it tracks, each once, under a random mix of operations.
+func TestEvictionPolicy_Tracking(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			policy := newEvictionPolicy(algorithm)
+			tracked := make(map[int64]bool)
+			r := rand.New(rand.NewSource(1))
+			for range 5000 {
+				id := int64(r.Intn(64))
+				switch op := r.Intn(4); {
+				case op == 0 && !tracked[id]:
+					policy.Insert(id)
+					tracked[id] = true
+				case op == 1 && tracked[id]:
+					policy.Access(id)
+				case op == 2:
+					policy.Remove(id)
+					delete(tracked, id)
+				case op == 3 && len(tracked) > 32:
+					victim, ok := policy.Victim(keep)
+					if !ok || !tracked[victim] {
+						t.Fatalf("Victim = %d, %v; want a tracked page", victim, ok)
+					}
+					delete(tracked, victim)
+				}
+				if policy.Len() != len(tracked) {
+					t.Fatalf("Len = %d, want %d", policy.Len(), len(tracked))
+				}
+			}
+
+			for len(tracked) > 0 {
+				victim, ok := policy.Victim(keep)
+				if !ok || !tracked[victim] {
+					t.Fatalf("Victim = %d, %v; want a tracked page", victim, ok)
+				}
+				delete(tracked, victim)
+			}
+			if _, ok := policy.Victim(keep); ok {
+				t.Fatal("Victim on an empty policy succeeded")
+			}
+		})
+	}
+}
+
+// TestEvictionPolicy_SkipHeld checks that every policy never evicts skipped
+// pages, keeps tracking them, and reports no victim when all pages are skipped.
+func TestEvictionPolicy_SkipHeld(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			policy := newEvictionPolicy(algorithm)
+			for id := range int64(16) {
+				policy.Insert(id)
+				policy.Access(id)
+			}
+			held := func(id int64) bool { return id%2 == 0 }
+			for range 8 {
+				victim, ok := policy.Victim(held)
+				if !ok || held(victim) {
+					t.Fatalf("Victim = %d, %v; want a page that is not held", victim, ok)
+				}
+			}
+			if victim, ok := policy.Victim(held); ok {
+				t.Fatalf("Victim = %d with every page held, want none", victim)
+			}
+			if policy.Len() != 8 {
+				t.Fatalf("Len = %d, want 8", policy.Len())
+			}
+		})
+	}
+}
+
+// TestEvictionPolicy_ScanResistance checks that 2Q and TinyLFU keep a hot
+// working set resident while a sequential scan streams through the cache,
+// including after the hot pages were read together with ReadPages.
+func TestEvictionPolicy_ScanResistance(t *testing.T) {
+	const hot = 16
+	for _, algorithm := range []EvictionAlgorithm{TwoQ, TinyLFU} {
+		for _, readPages := range []bool{false, true} {
+			name := algorithm.String()
+			if readPages {
+				name += "/ReadPages"
+			}
+			t.Run(name, func(t *testing.T) {
+				view := newTestView(t, Config{MaxCapacity: 2 * hot, Eviction: algorithm}, 2048)
+				// Warm up with the hot pages interleaved with a few cold ones, so
+				// the hot pages are evicted and re-referenced at least once.
+				cold := int64(hot)
+				ids := make([]int64, hot)
+				for id := range int64(hot) {
+					ids[id] = id
+				}
+				for range 8 {
+					for _, id := range ids {
+						if _, err := view.Read(id); err != nil {
+							t.Fatal(err)
+						}
+					}
+					for range hot / 2 {
+						if _, err := view.Read(cold); err != nil {
+							t.Fatal(err)
+						}
+						cold++
+					}
+				}
+				if readPages {
+					if _, err := view.ReadPages(ids); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for id := cold; id < 2048; id++ {
+					if _, err := view.Read(id); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				before := view.Stats().Hits
+				for _, id := range ids {
+					if _, err := view.Read(id); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if hits := view.Stats().Hits - before; hits != hot {
+					t.Fatalf("hot pages hit after scan = %d, want %d", hits, hot)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package diskview
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+const (
+	// sketchDepth is the number of independent hash rows in the sketch.
+	sketchDepth = 4
+
+	// sketchWidth is the number of counters per row.
+	sketchWidth = 1024
+)
+
+// PageHeat is the approximate number of accesses to a single page.
+type PageHeat struct {
+	ID    int64
+	Count uint64
+}
+
+// hotSampleSize is the number of recorded accesses, as a multiple of the
+// sketch width, after which all hot page counts are halved.
+const hotSampleSize = 10
+
+// hotTracker estimates per-page access frequencies with a count-min sketch and
+// keeps the k pages with the highest estimates in a min-heap, so the coldest
+// tracked page can be replaced in O(log k). Counts are approximate: they can
+// be overestimated when pages collide in every row. Every counter is halved
+// periodically, so pages that were hot long ago make way for current ones.
+type hotTracker struct {
+	mu      sync.Mutex
+	sketch  [sketchDepth][sketchWidth]uint64
+	samples int
+	k       int
+	top     []PageHeat
+	index   map[int64]int
+}
+
+// newHotTracker creates a tracker that reports the k hottest pages.
+func newHotTracker(k int) *hotTracker {
+	return &hotTracker{
+		k:     k,
+		top:   make([]PageHeat, 0, k),
+		index: make(map[int64]int, k),
+	}
+}
+
+// record counts one access to the page with the given ID.
+// This operation is thread-safe.
+func (h *hotTracker) record(id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for row := range sketchDepth {
+		h.sketch[row][sketchSlot(row, id)]++
+	}
+	if h.samples++; h.samples >= hotSampleSize*sketchWidth {
+		h.decay()
+	}
+
+	// The estimate is taken after any decay, so it is compared against
+	// tracked counts that were halved as well.
+	estimate := h.estimate(id)
+
+	if i, ok := h.index[id]; ok {
+		h.top[i].Count = estimate
+		h.fix(i)
+		return
+	}
+	if len(h.top) < h.k {
+		h.top = append(h.top, PageHeat{ID: id, Count: estimate})
+		h.index[id] = len(h.top) - 1
+		h.fix(len(h.top) - 1)
+		return
+	}
+	if estimate > h.top[0].Count {
+		delete(h.index, h.top[0].ID)
+		h.top[0] = PageHeat{ID: id, Count: estimate}
+		h.index[id] = 0
+		h.fix(0)
+	}
+}
+
+// estimate returns the estimated access count of the page with the given ID.
+// The caller must hold h.mu.
+func (h *hotTracker) estimate(id int64) uint64 {
+	estimate := h.sketch[0][sketchSlot(0, id)]
+	for row := 1; row < sketchDepth; row++ {
+		estimate = min(estimate, h.sketch[row][sketchSlot(row, id)])
+	}
+	return estimate
+}
+
+// decay halves every sketch counter and tracked count. Halving keeps the
+// order of the tracked counts, so the heap stays valid.
+// The caller must hold h.mu.
+func (h *hotTracker) decay() {
+	for row := range sketchDepth {
+		for i := range sketchWidth {
+			h.sketch[row][i] >>= 1
+		}
+	}
+	for i := range h.top {
+		h.top[i].Count >>= 1
+	}
+	h.samples = 0
+}
+
+// fix restores the heap order after the entry at index i changed, keeping
+// the index map in sync.
+// The caller must hold h.mu.
+func (h *hotTracker) fix(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h.top[parent].Count <= h.top[i].Count {
+			break
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+	for {
+		smallest := i
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(h.top) && h.top[child].Count < h.top[smallest].Count {
+				smallest = child
+			}
+		}
+		if smallest == i {
+			return
+		}
+		h.swap(i, smallest)
+		i = smallest
+	}
+}
+
+// swap exchanges two heap entries and updates their positions in the index.
+// The caller must hold h.mu.
+func (h *hotTracker) swap(i, j int) {
+	h.top[i], h.top[j] = h.top[j], h.top[i]
+	h.index[h.top[i].ID] = i
+	h.index[h.top[j].ID] = j
+}
+
+// report returns the tracked pages ordered from hottest to coldest.
+// This operation is thread-safe.
+func (h *hotTracker) report() []PageHeat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	heat := slices.Clone(h.top)
+	slices.SortFunc(heat, func(a, b PageHeat) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return heat
+}
+
+// sketchSlot hashes id into a counter index for the given sketch row using a
+// seeded splitmix64 finalizer, which gives each row an independent hash function.
+func sketchSlot(row int, id int64) uint64 {
+	x := uint64(id) + uint64(row+1)*0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return x % sketchWidth
+}
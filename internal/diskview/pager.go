@@ -1,19 +1,80 @@
 package diskview
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"sync"
 
+	"github.com/decoi-io/mint/internal/errs"
 	"github.com/edsrzf/mmap-go"
 )
 
-// Pager manages access to pages within a disk file using memory mapping.
-// It handles page-level I/O and maintains information about the file size
+// Storage is the backing medium a Pager reads pages from and writes pages to.
+// Any source that supports positioned reads and writes can back a Pager, which
+// allows encrypted containers, block devices and in-memory test doubles to be
+// used without changes to the DiskViewer.
+type Storage interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+
+	// Sync commits the written contents to stable storage.
+	Sync() error
+
+	// Size returns the current size of the storage in bytes.
+	Size() (int64, error)
+}
+
+// fileStorage adapts an *os.File to the Storage interface.
+type fileStorage struct {
+	*os.File
+}
+
+// NewFileStorage wraps the given file as a Storage. Pagers backed by a file
+// storage memory-map pages directly from the file.
+func NewFileStorage(file *os.File) Storage {
+	return &fileStorage{File: file}
+}
+
+// Size returns the size of the underlying file.
+func (f *fileStorage) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Pager manages access to pages within a Storage.
+// It handles page-level I/O and maintains information about the storage size
 // and page boundaries.
+//
+// When the storage is a file, pages are memory-mapped from the file and writes
+// to the mapping reach the file directly. For any other storage, pages are
+// read into anonymous mappings, so changes made through the mapping are not
+// visible to the storage until they are written back with Write.
+//
+// The size of the storage is read once when the Pager is created and then
+// tracked in memory as pages are written, so PageCount does not need a system
+// call on every invocation.
+//
+// Freed pages are kept in an in-memory free list and handed out again by
+// Allocate and AllocateSparse before the storage is grown. The free list is
+// not persisted, so pages freed before a restart are not reused after it.
+//
+// Pages appended by AllocateSparse are remembered as sparse until they are
+// first written through Write, so callers can route that first write through
+// the Pager instead of the mapping. Like the free list, this is not persisted.
 type Pager struct {
-	source   string
+	storage  Storage
 	file     *os.File
 	pageSize int
+	size     int64
+	free     []int64
+	freed    map[int64]struct{}
+	sparse   map[int64]struct{}
 	mu       sync.RWMutex
 }
 
@@ -25,11 +86,27 @@ func NewPager(source string) (*Pager, error) {
 	if err != nil {
 		return nil, err
 	}
+	return NewPagerFrom(NewFileStorage(file))
+}
+
+// NewPagerFrom creates a new Pager on top of the given storage.
+// The page size is set to the system's page size.
+// Returns an error if the size of the storage cannot be determined.
+func NewPagerFrom(storage Storage) (*Pager, error) {
+	size, err := storage.Size()
+	if err != nil {
+		return nil, ioError(err, "stat storage")
+	}
 
 	pager := &Pager{
-		source:   source,
-		file:     file,
+		storage:  storage,
 		pageSize: os.Getpagesize(),
+		size:     size,
+		freed:    make(map[int64]struct{}),
+		sparse:   make(map[int64]struct{}),
+	}
+	if fs, ok := storage.(*fileStorage); ok {
+		pager.file = fs.File
 	}
 	return pager, nil
 }
@@ -40,45 +117,280 @@ func NewPager(source string) (*Pager, error) {
 func (p *Pager) GetPage(id int64) (mmap.MMap, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
+	if err := p.checkRange(id, 1); err != nil {
+		return nil, err
+	}
 	offset := id * int64(p.pageSize)
-	region, err := mmap.MapRegion(p.file, p.pageSize, mmap.RDWR, 0, offset)
+	if p.file != nil {
+		region, err := mmap.MapRegion(p.file, p.pageSize, mmap.RDWR, 0, offset)
+		if err != nil {
+			return nil, ioError(err, "map page at offset %d", offset)
+		}
+		return region, nil
+	}
+
+	region, err := mmap.MapRegion(nil, p.pageSize, mmap.RDWR, mmap.ANON, 0)
 	if err != nil {
-		return nil, err
+		return nil, ioError(err, "map anonymous page")
+	}
+	if n, err := p.storage.ReadAt(region, offset); n < len(region) {
+		region.Unmap()
+		return nil, ioError(shortRead(err), "read at offset %d", offset)
 	}
 	return region, nil
 }
 
-// PageCount returns the number of complete pages in the file.
+// GetPages returns memory-mapped views of count consecutive pages starting at
+// the page with the given ID. File storages receive one read-ahead hint
+// covering the run, so the kernel can read it sequentially instead of faulting
+// the pages in one by one, but each page is still mapped separately: the
+// mappings are unmapped individually on eviction, which a shared mapping would
+// not allow. Other storages are read with a single ReadAt for the whole run.
+// Each returned mmap.MMap is independent and should be unmapped when no longer
+// needed.
+func (p *Pager) GetPages(start int64, count int) ([]mmap.MMap, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if err := p.checkRange(start, count); err != nil {
+		return nil, err
+	}
+	offset := start * int64(p.pageSize)
+	length := count * p.pageSize
+
+	var run []byte
+	if p.file != nil {
+		p.readahead(offset, int64(length))
+	} else {
+		run = make([]byte, length)
+		if n, err := p.storage.ReadAt(run, offset); n < len(run) {
+			return nil, ioError(shortRead(err), "read at offset %d", offset)
+		}
+	}
+
+	pages := make([]mmap.MMap, 0, count)
+	for i := range count {
+		var region mmap.MMap
+		var err error
+		if p.file != nil {
+			region, err = mmap.MapRegion(p.file, p.pageSize, mmap.RDWR, 0, offset+int64(i*p.pageSize))
+		} else {
+			region, err = mmap.MapRegion(nil, p.pageSize, mmap.RDWR, mmap.ANON, 0)
+			if err == nil {
+				copy(region, run[i*p.pageSize:])
+			}
+		}
+		if err != nil {
+			for _, page := range pages {
+				page.Unmap()
+			}
+			return nil, ioError(err, "map page at offset %d", offset+int64(i*p.pageSize))
+		}
+		pages = append(pages, region)
+	}
+	return pages, nil
+}
+
+// PageCount returns the number of complete pages in the storage.
 // Partial pages at the end are not counted.
-func (p *Pager) PageCount() (int64, error) {
+func (p *Pager) PageCount() int64 {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	info, err := p.file.Stat()
-	if err != nil {
+	return p.size / int64(p.pageSize)
+}
+
+// Allocate appends a zeroed page to the storage and returns its ID.
+// It handles partial writes by continuing until the full page is written.
+func (p *Pager) Allocate() (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) > 0 {
+		return p.reuse()
+	}
+	return p.zero(p.size / int64(p.pageSize))
+}
+
+// zero writes a page of zeros over the page with the given ID and returns the ID.
+// This is a thread-unsafe method
+func (p *Pager) zero(id int64) (int64, error) {
+	offset := id * int64(p.pageSize)
+	data := make([]byte, p.pageSize)
+	for len(data) > 0 {
+		n, err := p.write(data, offset)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write page at offset %d: %w", offset, err)
+		}
+		data = data[n:]
+		offset += int64(n)
+	}
+	return id, nil
+}
+
+// AllocateSparse appends a page to the storage by extending its size without
+// writing any data, and returns the page ID. On file systems with sparse file
+// support no blocks are allocated until the page is first written, and the
+// page reads back as zeros until then. Storages that cannot be truncated fall
+// back to Allocate.
+//
+// The page is reported by Sparse until it is written through Write. Writing
+// it through a shared mapping instead allocates its blocks in a page fault,
+// which raises SIGBUS rather than returning an error when the disk is full.
+func (p *Pager) AllocateSparse() (int64, error) {
+	truncater, ok := p.storage.(interface{ Truncate(size int64) error })
+	if !ok {
+		return p.Allocate()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) > 0 {
+		return p.reuse()
+	}
+	id := p.size / int64(p.pageSize)
+	size := (id + 1) * int64(p.pageSize)
+	if err := truncater.Truncate(size); err != nil {
+		return 0, ioError(err, "extend storage to %d bytes", size)
+	}
+	p.size = size
+	p.sparse[id] = struct{}{}
+	return id, nil
+}
+
+// Sparse reports whether the page with the given ID was appended by
+// AllocateSparse and has not been written through Write since, so its blocks
+// may not be allocated yet.
+func (p *Pager) Sparse(id int64) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.sparse[id]
+	return ok
+}
+
+// Free returns the page with the given ID to the free list so a later
+// allocation can reuse it. Returns errs.ErrPageNotFound if the page is not
+// allocated, including when it has already been freed.
+func (p *Pager) Free(id int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.checkRange(id, 1); err != nil {
+		return err
+	}
+	p.free = append(p.free, id)
+	p.freed[id] = struct{}{}
+	return nil
+}
+
+// HasFree reports whether a freed page is available for reuse, in which case
+// the next allocation does not grow the storage.
+func (p *Pager) HasFree() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.free) > 0
+}
+
+// Allocated reports whether the page with the given ID is allocated, that is,
+// within the storage and not freed.
+func (p *Pager) Allocated(id int64) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.checkRange(id, 1) == nil
+}
+
+// reuse takes the most recently freed page off the free list and zeroes it.
+// This is a thread-unsafe method
+func (p *Pager) reuse() (int64, error) {
+	id := p.free[len(p.free)-1]
+	if _, err := p.zero(id); err != nil {
 		return 0, err
 	}
-	return info.Size() / int64(p.pageSize), nil
+	p.free = p.free[:len(p.free)-1]
+	delete(p.freed, id)
+	return id, nil
+}
+
+// Read reads len(buf) bytes from the storage at the given offset, bypassing
+// any mapping. Returns the number of bytes read and any error encountered.
+func (p *Pager) Read(buf []byte, offset int64) (int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n, err := p.storage.ReadAt(buf, offset)
+	return n, ioError(err, "read at offset %d", offset)
 }
 
-// Write writes count zero bytes at the given offset.
+// Write writes data to the storage at the given offset.
 // Returns the number of bytes written and any error encountered.
 // May return a partial write count if an error occurs.
-func (p *Pager) Write(count int, offset int64) (int, error) {
+func (p *Pager) Write(data []byte, offset int64) (int, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	return p.write(data, offset)
+}
 
-	data := make([]byte, count)
-	n, err := p.file.WriteAt(data, offset)
-	if err != nil {
-		return n, err
+// write writes data at the given offset and extends the tracked size if the
+// write went past the current end of the storage. Sparse pages touched by the
+// written bytes are no longer reported by Sparse.
+// This is a thread-unsafe method
+func (p *Pager) write(data []byte, offset int64) (int, error) {
+	n, err := p.storage.WriteAt(data, offset)
+	p.size = max(p.size, offset+int64(n))
+	if len(p.sparse) > 0 && n > 0 {
+		for id := offset / int64(p.pageSize); id <= (offset+int64(n)-1)/int64(p.pageSize); id++ {
+			delete(p.sparse, id)
+		}
 	}
+	return n, ioError(err, "write at offset %d", offset)
+}
 
-	return n, nil
+// checkRange returns errs.ErrPageNotFound if any of the count pages starting at
+// start lies outside the storage or has been freed.
+// This is a thread-unsafe method
+func (p *Pager) checkRange(start int64, count int) error {
+	if pages := p.size / int64(p.pageSize); start < 0 || start+int64(count) > pages {
+		return fmt.Errorf("%w: pages [%d, %d) of %d", errs.ErrPageNotFound, start, start+int64(count), pages)
+	}
+	if len(p.freed) == 0 {
+		return nil
+	}
+	for id := start; id < start+int64(count); id++ {
+		if _, ok := p.freed[id]; ok {
+			return fmt.Errorf("%w: page %d is free", errs.ErrPageNotFound, id)
+		}
+	}
+	return nil
 }
 
-// Close closes the underlying file.
+// Sync commits the storage contents to stable storage.
+func (p *Pager) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.storage.Sync(); err != nil {
+		return ioError(err, "sync")
+	}
+	return nil
+}
+
+// Close closes the underlying storage.
 func (p *Pager) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.file.Close()
+	return p.storage.Close()
+}
+
+// ioError wraps a failed storage operation with errs.ErrIOFailure, keeping err
+// reachable through errors.Is and errors.As. The operation is described by
+// format and args. Errors that already wrap errs.ErrIOFailure, and nil, are
+// returned unchanged.
+func ioError(err error, format string, args ...any) error {
+	if err == nil || errors.Is(err, errs.ErrIOFailure) {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %w", errs.ErrIOFailure, fmt.Sprintf(format, args...), err)
+}
+
+// shortRead returns err, or io.ErrUnexpectedEOF if a storage returned fewer
+// bytes than requested without reporting why.
+func shortRead(err error) error {
+	if err == nil {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
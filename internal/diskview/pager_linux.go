@@ -0,0 +1,24 @@
+package diskview
+
+import "golang.org/x/sys/unix"
+
+// readahead hints the kernel to start reading length bytes at offset into the
+// page cache so the following page faults on the mapped run are served from
+// memory. The hint is best-effort and errors are ignored.
+func (p *Pager) readahead(offset, length int64) {
+	_ = unix.Fadvise(int(p.file.Fd()), offset, length, unix.FADV_WILLNEED)
+}
+
+// freeSpace returns the number of bytes available to unprivileged users on the
+// file system holding the file. The boolean is false when the free space
+// cannot be determined, which is always the case for non-file storages.
+func (p *Pager) freeSpace() (uint64, bool, error) {
+	if p.file == nil {
+		return 0, false, nil
+	}
+	var stat unix.Statfs_t
+	if err := unix.Fstatfs(int(p.file.Fd()), &stat); err != nil {
+		return 0, false, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), true, nil
+}
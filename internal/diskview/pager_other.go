@@ -0,0 +1,11 @@
+//go:build !linux
+
+package diskview
+
+// readahead is a no-op on platforms without posix_fadvise.
+func (p *Pager) readahead(offset, length int64) {}
+
+// freeSpace reports that free space cannot be determined on this platform.
+func (p *Pager) freeSpace() (uint64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,54 @@
+// Package errs defines the sentinel errors shared by all of mint's subsystems.
+//
+// Subsystems wrap these sentinels with fmt.Errorf and %w to add context, so
+// callers can always classify a failure with errors.Is regardless of which
+// layer produced it.
+package errs
+
+import "errors"
+
+var (
+	// ErrClosed is returned when an operation is attempted on a closed resource.
+	ErrClosed = errors.New("closed")
+
+	// ErrReadOnly is returned when a write is attempted on a read-only resource.
+	ErrReadOnly = errors.New("read-only")
+
+	// ErrCorrupted is returned when on-disk data fails validation.
+	ErrCorrupted = errors.New("corrupted")
+
+	// ErrConflict is returned when a transaction conflicts with a concurrent one.
+	ErrConflict = errors.New("conflict")
+
+	// ErrTxnTooLarge is returned when a transaction exceeds its size limit.
+	ErrTxnTooLarge = errors.New("transaction too large")
+
+	// ErrKeyNotFound is returned when a key does not exist.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrBucketNotFound is returned when a bucket does not exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrNoSpace is returned when a write is refused because free disk space is low.
+	ErrNoSpace = errors.New("no space left")
+
+	// ErrIOFailure is returned when the underlying storage fails an I/O operation.
+	ErrIOFailure = errors.New("i/o failure")
+
+	// ErrInvalidConfig is returned when a configuration fails validation.
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrPageNotFound is returned when a page ID lies outside the allocated pages.
+	ErrPageNotFound = errors.New("page not found")
+
+	// ErrOutOfBounds is returned when a partial page access falls outside the page.
+	ErrOutOfBounds = errors.New("access out of page bounds")
+
+	// ErrTooManyPages is returned when a vectored read requests more distinct
+	// pages than the cache can hold at once.
+	ErrTooManyPages = errors.New("too many pages for cache capacity")
+
+	// ErrPinLimit is returned when pinning a page would exceed the pinned
+	// page budget.
+	ErrPinLimit = errors.New("pinned page limit reached")
+)